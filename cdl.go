@@ -0,0 +1,414 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package cmx3600
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Avalanche-io/gotio"
+)
+
+// cdlNamespace is the XML namespace of ASC CDL files.
+const cdlNamespace = "urn:ASC:CDL:v1.01"
+
+// unsafeFileNameRegex matches the characters of a ColorCorrection id that
+// are replaced in the name of its .cc file.
+var unsafeFileNameRegex = regexp.MustCompile(`[^\w.-]+`)
+
+// CDLFormat represents an ASC CDL XML file format.
+type CDLFormat string
+
+const (
+	// CDLFormatCC writes each ColorCorrection to its own .cc file.
+	CDLFormatCC CDLFormat = "cc"
+	// CDLFormatCCC writes a ColorCorrectionCollection .ccc file.
+	CDLFormatCCC CDLFormat = "ccc"
+	// CDLFormatCDL writes a ColorDecisionList .cdl file.
+	CDLFormatCDL CDLFormat = "cdl"
+)
+
+// CDLID selects what the id of an event's ColorCorrection is built from.
+type CDLID string
+
+const (
+	// CDLIDClipName uses the clip name, or the reel when there is none.
+	CDLIDClipName CDLID = "clip_name"
+	// CDLIDReel uses the reel name.
+	CDLIDReel CDLID = "reel"
+)
+
+// ColorCorrection is an ASC CDL grade with the id it is exchanged under.
+type ColorCorrection struct {
+	ID  string
+	CDL ASCCDL
+}
+
+// xmlColorCorrection is the ColorCorrection element of an ASC CDL file.
+// Older files name the saturation node SATNode.
+type xmlColorCorrection struct {
+	ID        string      `xml:"id,attr,omitempty"`
+	SOP       xmlSOPNode  `xml:"SOPNode"`
+	Sat       xmlSatNode  `xml:"SatNode"`
+	LegacySat *xmlSatNode `xml:"SATNode,omitempty"`
+}
+
+type xmlSOPNode struct {
+	Slope  string `xml:"Slope"`
+	Offset string `xml:"Offset"`
+	Power  string `xml:"Power"`
+}
+
+type xmlSatNode struct {
+	Saturation string `xml:"Saturation"`
+}
+
+// xmlCC is the root element of a .cc file.
+type xmlCC struct {
+	XMLName xml.Name `xml:"ColorCorrection"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	xmlColorCorrection
+}
+
+// xmlCCC is the root element of a .ccc file.
+type xmlCCC struct {
+	XMLName     xml.Name             `xml:"ColorCorrectionCollection"`
+	Xmlns       string               `xml:"xmlns,attr,omitempty"`
+	Corrections []xmlColorCorrection `xml:"ColorCorrection"`
+}
+
+// xmlCDL is the root element of a .cdl file.
+type xmlCDL struct {
+	XMLName   xml.Name           `xml:"ColorDecisionList"`
+	Xmlns     string             `xml:"xmlns,attr,omitempty"`
+	Decisions []xmlColorDecision `xml:"ColorDecision"`
+}
+
+type xmlColorDecision struct {
+	Correction xmlColorCorrection `xml:"ColorCorrection"`
+}
+
+// EventCorrections returns the ColorCorrections of the events that have an
+// ASC CDL, with ids built from each event's clip name or reel. Events
+// sharing an id and a grade share the ColorCorrection of the first of them;
+// an event with a grade not yet seen for its id has its own, with its event
+// number added to the id.
+func EventCorrections(events []EDLEvent, id CDLID) []ColorCorrection {
+	var corrections []ColorCorrection
+	for _, event := range events {
+		if event.ASCCDL == nil {
+			continue
+		}
+		corrections = addCorrection(corrections, correctionID(event.ClipName, event.ReelName, id), event.EventNumber, *event.ASCCDL)
+	}
+	return corrections
+}
+
+// TimelineCorrections returns the ColorCorrections of the clips on the video
+// tracks of a timeline that have cdl metadata, with ids built as for
+// EventCorrections. Clips decoded from an EDL keep their event numbers, and
+// other clips are numbered in track order.
+func TimelineCorrections(t *gotio.Timeline, id CDLID) []ColorCorrection {
+	var corrections []ColorCorrection
+	number := 0
+	for _, track := range t.VideoTracks() {
+		for _, child := range track.Children() {
+			clip, ok := child.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			number++
+			if eventNumber, _, _ := sourceEvent(clip); eventNumber > 0 {
+				number = eventNumber
+			}
+			if cdl := clipCDL(clip); cdl != nil {
+				corrections = addCorrection(corrections, correctionID(clip.Name(), clipReel(clip, DefaultGeneratorTable()), id), number, *cdl)
+			}
+		}
+	}
+	return corrections
+}
+
+// correctionID returns the ColorCorrection id of a clip.
+func correctionID(clipName, reel string, id CDLID) string {
+	if id == CDLIDClipName && clipName != "" {
+		return clipName
+	}
+	return reel
+}
+
+// numberedID returns the id of the ColorCorrection of an event whose grade
+// differs from the first with the same id.
+func numberedID(id string, number int) string {
+	return fmt.Sprintf("%s_%03d", id, number)
+}
+
+// addCorrection adds the grade of event number to corrections under id,
+// unless the same grade is already there under that id or one of its
+// numbered ids. A different grade is added under the numbered id of the
+// event, so that ApplyCorrections finds it again.
+func addCorrection(corrections []ColorCorrection, id string, number int, cdl ASCCDL) []ColorCorrection {
+	found := false
+	for _, correction := range corrections {
+		if correction.ID != id && !isNumberedID(correction.ID, id) {
+			continue
+		}
+		if correction.CDL == cdl {
+			return corrections
+		}
+		found = true
+	}
+	if found {
+		id = numberedID(id, number)
+	}
+	for _, correction := range corrections {
+		if correction.ID == id {
+			return corrections
+		}
+	}
+	return append(corrections, ColorCorrection{ID: id, CDL: cdl})
+}
+
+// isNumberedID reports whether id is a numbered id of base.
+func isNumberedID(id, base string) bool {
+	suffix, ok := strings.CutPrefix(id, base+"_")
+	if !ok || len(suffix) < 3 {
+		return false
+	}
+	_, err := strconv.Atoi(suffix)
+	return err == nil
+}
+
+// WriteCC writes a ColorCorrection as a .cc file.
+func WriteCC(w io.Writer, correction ColorCorrection) error {
+	return writeXML(w, xmlCC{Xmlns: cdlNamespace, xmlColorCorrection: toXMLCorrection(correction)})
+}
+
+// WriteCCC writes ColorCorrections as a .ccc ColorCorrectionCollection.
+func WriteCCC(w io.Writer, corrections []ColorCorrection) error {
+	collection := xmlCCC{Xmlns: cdlNamespace}
+	for _, correction := range corrections {
+		collection.Corrections = append(collection.Corrections, toXMLCorrection(correction))
+	}
+	return writeXML(w, collection)
+}
+
+// WriteCDL writes ColorCorrections as a .cdl ColorDecisionList, with one
+// ColorDecision for each.
+func WriteCDL(w io.Writer, corrections []ColorCorrection) error {
+	list := xmlCDL{Xmlns: cdlNamespace}
+	for _, correction := range corrections {
+		list.Decisions = append(list.Decisions, xmlColorDecision{Correction: toXMLCorrection(correction)})
+	}
+	return writeXML(w, list)
+}
+
+// ExportCDLFiles writes ColorCorrections to files in dir and returns the
+// paths written. The cc format writes one file per ColorCorrection, named
+// after its id, with a number added to names that would otherwise be the
+// same; the ccc and cdl formats write a single file named name.
+func ExportCDLFiles(dir, name string, corrections []ColorCorrection, format CDLFormat) ([]string, error) {
+	var paths []string
+	switch format {
+	case CDLFormatCC:
+		// Names are compared ignoring case, for case-insensitive file
+		// systems
+		used := make(map[string]bool, len(corrections))
+		for _, correction := range corrections {
+			base := unsafeFileNameRegex.ReplaceAllString(correction.ID, "_")
+			fileName := base
+			for n := 2; used[strings.ToLower(fileName)]; n++ {
+				fileName = fmt.Sprintf("%s_%d", base, n)
+			}
+			used[strings.ToLower(fileName)] = true
+
+			path := filepath.Join(dir, fileName+".cc")
+			if err := writeFile(path, func(w io.Writer) error { return WriteCC(w, correction) }); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+		}
+	case CDLFormatCCC, CDLFormatCDL:
+		path := filepath.Join(dir, name+"."+string(format))
+		write := func(w io.Writer) error { return WriteCCC(w, corrections) }
+		if format == CDLFormatCDL {
+			write = func(w io.Writer) error { return WriteCDL(w, corrections) }
+		}
+		if err := writeFile(path, write); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	default:
+		return nil, fmt.Errorf("unknown CDL format %q", format)
+	}
+	return paths, nil
+}
+
+// ReadCDLs reads the ColorCorrections of a .ccc, .cdl or .cc file.
+func ReadCDLs(r io.Reader) ([]ColorCorrection, error) {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no ColorCorrection found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var elements []xmlColorCorrection
+		switch start.Name.Local {
+		case "ColorCorrectionCollection":
+			var collection xmlCCC
+			if err := decoder.DecodeElement(&collection, &start); err != nil {
+				return nil, err
+			}
+			elements = collection.Corrections
+		case "ColorDecisionList":
+			var list xmlCDL
+			if err := decoder.DecodeElement(&list, &start); err != nil {
+				return nil, err
+			}
+			for _, decision := range list.Decisions {
+				elements = append(elements, decision.Correction)
+			}
+		case "ColorCorrection":
+			var cc xmlCC
+			if err := decoder.DecodeElement(&cc, &start); err != nil {
+				return nil, err
+			}
+			elements = append(elements, cc.xmlColorCorrection)
+		default:
+			return nil, fmt.Errorf("unknown ASC CDL element %q", start.Name.Local)
+		}
+
+		corrections := make([]ColorCorrection, 0, len(elements))
+		for _, element := range elements {
+			correction, err := fromXMLCorrection(element)
+			if err != nil {
+				return nil, err
+			}
+			corrections = append(corrections, correction)
+		}
+		return corrections, nil
+	}
+}
+
+// ApplyCorrections sets the ASC CDL of each event whose id, built as for
+// EventCorrections, matches a ColorCorrection. The ColorCorrection under the
+// event's numbered id is used before the one under its id, so an event that
+// repeats the grade of an earlier numbered event gets the grade of its id.
+// It returns the number of events graded.
+func ApplyCorrections(events []EDLEvent, corrections []ColorCorrection, id CDLID) int {
+	byID := make(map[string]ASCCDL, len(corrections))
+	for _, correction := range corrections {
+		byID[correction.ID] = correction.CDL
+	}
+
+	graded := 0
+	for i := range events {
+		eventID := correctionID(events[i].ClipName, events[i].ReelName, id)
+		cdl, ok := byID[numberedID(eventID, events[i].EventNumber)]
+		if !ok {
+			cdl, ok = byID[eventID]
+		}
+		if !ok {
+			continue
+		}
+		events[i].ASCCDL = &cdl
+		graded++
+	}
+	return graded
+}
+
+// toXMLCorrection returns the XML element of a ColorCorrection.
+func toXMLCorrection(correction ColorCorrection) xmlColorCorrection {
+	cdl := correction.CDL
+	return xmlColorCorrection{
+		ID: correction.ID,
+		SOP: xmlSOPNode{
+			Slope:  formatCDLValues(cdl.Slope, -1),
+			Offset: formatCDLValues(cdl.Offset, -1),
+			Power:  formatCDLValues(cdl.Power, -1),
+		},
+		Sat: xmlSatNode{Saturation: strconv.FormatFloat(cdl.Saturation, 'f', -1, 64)},
+	}
+}
+
+// fromXMLCorrection returns the ColorCorrection of an XML element.
+func fromXMLCorrection(element xmlColorCorrection) (ColorCorrection, error) {
+	correction := ColorCorrection{ID: element.ID}
+	for _, node := range []struct {
+		name   string
+		text   string
+		values *[3]float64
+	}{
+		{"Slope", element.SOP.Slope, &correction.CDL.Slope},
+		{"Offset", element.SOP.Offset, &correction.CDL.Offset},
+		{"Power", element.SOP.Power, &correction.CDL.Power},
+	} {
+		fields := strings.Fields(node.text)
+		if len(fields) != len(node.values) {
+			return correction, fmt.Errorf("ColorCorrection %q: %s must have 3 values", element.ID, node.name)
+		}
+		for i, field := range fields {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return correction, fmt.Errorf("ColorCorrection %q: invalid %s value %q", element.ID, node.name, field)
+			}
+			node.values[i] = value
+		}
+	}
+
+	saturation := element.Sat.Saturation
+	if element.LegacySat != nil {
+		saturation = element.LegacySat.Saturation
+	}
+	correction.CDL.Saturation = 1
+	if saturation = strings.TrimSpace(saturation); saturation != "" {
+		value, err := strconv.ParseFloat(saturation, 64)
+		if err != nil {
+			return correction, fmt.Errorf("ColorCorrection %q: invalid Saturation value %q", element.ID, saturation)
+		}
+		correction.CDL.Saturation = value
+	}
+	return correction, nil
+}
+
+// writeXML writes an ASC CDL XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "    ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeFile creates path and writes it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package cmx3600
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCDL_ExportAndImport(t *testing.T) {
+	edl := `TITLE: Grades
+FCM: NON-DROP FRAME
+
+001  A001     V     C        01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Shot 1
+*ASC_SOP (1.1 1 0.95)(0 -0.01 0.02)(1 1 1)
+*ASC_SAT 0.9
+
+002  A002     V     C        02:00:00:00 02:00:05:00 00:00:05:00 00:00:10:00
+* FROM CLIP NAME: Shot 2
+
+003  A001     V     C        01:00:10:00 01:00:15:00 00:00:10:00 00:00:15:00
+* FROM CLIP NAME: Shot 1
+*ASC_SOP (1.1 1 0.95)(0 -0.01 0.02)(1 1 1)
+*ASC_SAT 0.9
+
+004  A003     V     C        03:00:00:00 03:00:05:00 00:00:15:00 00:00:20:00
+* FROM CLIP NAME: Shot 1
+*ASC_SOP (1 1 1)(0 0 0)(1.2 1.2 1.2)
+*ASC_SAT 1
+
+005  A004     V     C        04:00:00:00 04:00:05:00 00:00:20:00 00:00:25:00
+* FROM CLIP NAME: Shot 1
+*ASC_SOP (1 1 1)(0 0 0)(1.2 1.2 1.2)
+*ASC_SAT 0.8
+`
+
+	var events []EDLEvent
+	for event, err := range NewEventReader(strings.NewReader(edl)).Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		events = append(events, event)
+	}
+
+	// Event 003 repeats the grade of event 001, and events 004 and 005
+	// have the same clip name with different grades
+	corrections := EventCorrections(events, CDLIDClipName)
+	var ids []string
+	for _, correction := range corrections {
+		ids = append(ids, correction.ID)
+	}
+	if !slices.Equal(ids, []string{"Shot 1", "Shot 1_004", "Shot 1_005"}) {
+		t.Fatalf("Expected ids [Shot 1 Shot 1_004 Shot 1_005], got %v", ids)
+	}
+
+	// A decoded timeline gives the same ColorCorrections
+	timeline, err := NewDecoder(strings.NewReader(edl)).Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if fromTimeline := TimelineCorrections(timeline, CDLIDClipName); !reflect.DeepEqual(fromTimeline, corrections) {
+		t.Errorf("Expected timeline corrections %v, got %v", corrections, fromTimeline)
+	}
+
+	reels := EventCorrections(events, CDLIDReel)
+	if len(reels) != 3 || reels[0].ID != "A001" || reels[1].ID != "A003" || reels[2].ID != "A004" {
+		t.Errorf("Expected reel ids A001, A003 and A004, got %v", reels)
+	}
+
+	for _, format := range []CDLFormat{CDLFormatCC, CDLFormatCCC, CDLFormatCDL} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			paths, err := ExportCDLFiles(dir, "grades", corrections, format)
+			if err != nil {
+				t.Fatalf("ExportCDLFiles() error = %v", err)
+			}
+
+			var read []ColorCorrection
+			for _, path := range paths {
+				if filepath.Ext(path) != "."+string(format) {
+					t.Errorf("Expected .%s file, got %s", format, path)
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("ReadFile() error = %v", err)
+				}
+				cdls, err := ReadCDLs(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("ReadCDLs() error = %v\n%s", err, data)
+				}
+				read = append(read, cdls...)
+			}
+			if !reflect.DeepEqual(read, corrections) {
+				t.Errorf("Expected %v, got %v", corrections, read)
+			}
+		})
+	}
+
+	// Grades are attached to the ungraded events by id, each event getting
+	// back its own grade
+	ungraded := slices.Clone(events)
+	for i := range ungraded {
+		ungraded[i].ASCCDL = nil
+	}
+	if graded := ApplyCorrections(ungraded, corrections, CDLIDClipName); graded != 4 {
+		t.Errorf("Expected 4 events graded, got %d", graded)
+	}
+	for i := range events {
+		if !reflect.DeepEqual(ungraded[i].ASCCDL, events[i].ASCCDL) {
+			t.Errorf("Event %03d: expected grade %v, got %v", events[i].EventNumber, events[i].ASCCDL, ungraded[i].ASCCDL)
+		}
+	}
+}
+
+func TestCDL_RepeatedNumberedGrade(t *testing.T) {
+	grade := func(slope float64) *ASCCDL {
+		return &ASCCDL{Slope: [3]float64{slope, slope, slope}, Power: [3]float64{1, 1, 1}, Saturation: 1}
+	}
+	events := []EDLEvent{
+		{EventNumber: 1, ClipName: "Shot 1", ReelName: "A001", ASCCDL: grade(1)},
+		{EventNumber: 2, ClipName: "Shot 1", ReelName: "A001", ASCCDL: grade(1.2)},
+		{EventNumber: 3, ClipName: "Shot 1", ReelName: "A001", ASCCDL: grade(1.2)},
+	}
+
+	// Event 3 repeats the grade of event 2, stored under its numbered id
+	corrections := EventCorrections(events, CDLIDClipName)
+	var ids []string
+	for _, correction := range corrections {
+		ids = append(ids, correction.ID)
+	}
+	if !slices.Equal(ids, []string{"Shot 1", "Shot 1_002"}) {
+		t.Fatalf("Expected ids [Shot 1 Shot 1_002], got %v", ids)
+	}
+	if corrections[1].CDL != *grade(1.2) {
+		t.Errorf("Expected grade %v for Shot 1_002, got %v", *grade(1.2), corrections[1].CDL)
+	}
+}
+
+func TestCDL_ExportFileNames(t *testing.T) {
+	// Ids that are the same once made safe for file names are written to
+	// files of their own
+	corrections := []ColorCorrection{
+		{ID: "Shot 1", CDL: ASCCDL{Slope: [3]float64{1, 1, 1}, Power: [3]float64{1, 1, 1}, Saturation: 1}},
+		{ID: "Shot/1", CDL: ASCCDL{Slope: [3]float64{2, 2, 2}, Power: [3]float64{1, 1, 1}, Saturation: 1}},
+		{ID: "shot_1", CDL: ASCCDL{Slope: [3]float64{3, 3, 3}, Power: [3]float64{1, 1, 1}, Saturation: 1}},
+	}
+
+	dir := t.TempDir()
+	paths, err := ExportCDLFiles(dir, "grades", corrections, CDLFormatCC)
+	if err != nil {
+		t.Fatalf("ExportCDLFiles() error = %v", err)
+	}
+
+	var names []string
+	for i, path := range paths {
+		names = append(names, filepath.Base(path))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		read, err := ReadCDLs(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadCDLs() error = %v", err)
+		}
+		if !reflect.DeepEqual(read, corrections[i:i+1]) {
+			t.Errorf("Expected %v in %s, got %v", corrections[i], names[i], read)
+		}
+	}
+	if !slices.Equal(names, []string{"Shot_1.cc", "Shot_1_2.cc", "shot_1_3.cc"}) {
+		t.Errorf("Expected unique file names, got %v", names)
+	}
+}
+
+func TestCDL_ReadCCC(t *testing.T) {
+	ccc := `<?xml version="1.0" encoding="UTF-8"?>
+<ColorCorrectionCollection xmlns="urn:ASC:CDL:v1.01">
+    <ColorCorrection id="A001">
+        <SOPNode>
+            <Description>Day exterior</Description>
+            <Slope>1.1 1.0 0.95</Slope>
+            <Offset>0.0 -0.01 0.02</Offset>
+            <Power>1.0 1.0 1.0</Power>
+        </SOPNode>
+        <SATNode>
+            <Saturation>0.9</Saturation>
+        </SATNode>
+    </ColorCorrection>
+    <ColorCorrection id="A002">
+        <SOPNode>
+            <Slope>1 1</Slope>
+            <Offset>0 0 0</Offset>
+            <Power>1 1 1</Power>
+        </SOPNode>
+    </ColorCorrection>
+</ColorCorrectionCollection>
+`
+
+	if _, err := ReadCDLs(strings.NewReader(ccc)); err == nil || !strings.Contains(err.Error(), "A002") {
+		t.Errorf("Expected error for ColorCorrection A002, got %v", err)
+	}
+
+	valid := ccc[:strings.Index(ccc, `    <ColorCorrection id="A002">`)] + "</ColorCorrectionCollection>\n"
+	corrections, err := ReadCDLs(strings.NewReader(valid))
+	if err != nil {
+		t.Fatalf("ReadCDLs() error = %v", err)
+	}
+	expected := []ColorCorrection{{
+		ID: "A001",
+		CDL: ASCCDL{
+			Slope:      [3]float64{1.1, 1, 0.95},
+			Offset:     [3]float64{0, -0.01, 0.02},
+			Power:      [3]float64{1, 1, 1},
+			Saturation: 0.9,
+		},
+	}}
+	if !reflect.DeepEqual(corrections, expected) {
+		t.Errorf("Expected %v, got %v", expected, corrections)
+	}
+}
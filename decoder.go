@@ -4,10 +4,13 @@
 package cmx3600
 
 import (
-	"bufio"
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
-	"regexp"
+	"maps"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -21,13 +24,26 @@ type Decoder struct {
 	rate                   float64
 	ignoreTimecodeMismatch bool
 	fcmMode                string // "DROP FRAME" or "NON-DROP FRAME"
+	title                  string
+	headerComments         []string
+	adjustments            []TimecodeAdjustment
+	mode                   DecodeMode
+	diagnostics            []Diagnostic
+	trackOrder             func(a, b TrackType) int
+	trackNamer             TrackNamer
+	sourceLines            bool
+	generators             GeneratorTable
 }
 
 // NewDecoder creates a new EDL decoder.
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
-		r:    r,
-		rate: 24.0, // Default frame rate
+		r:          r,
+		rate:       24.0, // Default frame rate
+		mode:       DecodeModeDefault,
+		trackOrder: CompareTrackTypes,
+		trackNamer: DefaultTrackNamer,
+		generators: DefaultGeneratorTable(),
 	}
 }
 
@@ -43,231 +59,341 @@ func (d *Decoder) SetIgnoreTimecodeMismatch(ignore bool) {
 	d.ignoreTimecodeMismatch = ignore
 }
 
-// eventLineRegex matches an EDL event line.
-// Format: EVENT# REEL TRACK EDIT_TYPE [TRANSITION_DURATION]
-var eventLineRegex = regexp.MustCompile(`^\s*(\d+)\s+(\S+)\s+(V|A\d?|AA)\s+(C|D|W\d{3}|KB|K)\s*(\d+)?`)
+// SetTrackOrder sets the comparison function used to order the tracks of the
+// decoded timeline. The default, CompareTrackTypes, puts video first and then
+// audio channels in ascending order. The layers of overlapping events on a
+// channel follow its first track, and key tracks always follow the other
+// tracks, in the same order.
+func (d *Decoder) SetTrackOrder(compare func(a, b TrackType) int) {
+	if compare == nil {
+		compare = CompareTrackTypes
+	}
+	d.trackOrder = compare
+}
 
-// timecodeLineRegex matches a timecode line.
-// Format: SOURCE_IN SOURCE_OUT RECORD_IN RECORD_OUT
-var timecodeLineRegex = regexp.MustCompile(`^\s*(\d{2}:\d{2}:\d{2}[;:]\d{2})\s+(\d{2}:\d{2}:\d{2}[;:]\d{2})\s+(\d{2}:\d{2}:\d{2}[;:]\d{2})\s+(\d{2}:\d{2}:\d{2}[;:]\d{2})`)
+// SetTrackNamer sets the function used to name the tracks of the decoded
+// timeline. The default is DefaultTrackNamer.
+func (d *Decoder) SetTrackNamer(namer TrackNamer) {
+	if namer == nil {
+		namer = DefaultTrackNamer
+	}
+	d.trackNamer = namer
+}
 
-// speedEffectRegex matches an M2 motion effect line.
-// Format: M2 REEL SPEED TIMECODE
-var speedEffectRegex = regexp.MustCompile(`^M2\s+(?P<name>\S+)\s+(?P<speed>-?[0-9.]+)\s+(?P<tc>\d{2}:\d{2}:\d{2}:\d{2})`)
+// SetGeneratorTable sets the reels decoded as generated sources. The default
+// is DefaultGeneratorTable.
+func (d *Decoder) SetGeneratorTable(table GeneratorTable) {
+	if table == nil {
+		table = DefaultGeneratorTable()
+	}
+	d.generators = table
+}
 
-// markerRegex matches a locator/marker line.
-// Format: * LOC: TIMECODE COLOR COMMENT
-var markerRegex = regexp.MustCompile(`^\*\s*LOC:\s+(\d{2}:\d{2}:\d{2}:\d{2})\s+(\w*)(\s+|$)(.*)`)
+// SetMode sets how problems in the EDL are handled. In lenient mode events
+// that cannot be read are skipped and decoding carries on, in strict mode
+// any problem is an error.
+func (d *Decoder) SetMode(mode DecodeMode) {
+	d.mode = mode
+}
 
-// ascSOPRegex matches ASC_SOP (slope, offset, power) values.
-var ascSOPRegex = regexp.MustCompile(`ASC_SOP\s*\(\s*([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)\s*\)\s*\(\s*([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)\s*\)\s*\(\s*([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)\s*\)`)
+// SetSourceLines sets whether each clip records the first and last line of
+// its event in the EDL, as "line" and "end_line" in its "cmx_3600" metadata.
+func (d *Decoder) SetSourceLines(keep bool) {
+	d.sourceLines = keep
+}
 
-// ascSATRegex matches ASC_SAT (saturation) value.
-var ascSATRegex = regexp.MustCompile(`ASC_SAT\s+([-+]?[\d.]+)`)
+// Diagnostics returns the problems found in the EDL by the last call to
+// Decode.
+func (d *Decoder) Diagnostics() []Diagnostic {
+	return d.diagnostics
+}
+
+// Adjustments returns the record timecode corrections made by the last call
+// to Decode. It is only populated when timecode mismatches are ignored.
+func (d *Decoder) Adjustments() []TimecodeAdjustment {
+	return d.adjustments
+}
+
+// maxRecordDrift is the largest distance, in frames, between an event's
+// record in and the previous event's record out that is treated as drift
+// rather than an intentional gap or overlap.
+const maxRecordDrift = 1
 
 // Decode reads the EDL and returns an OpenTimelineIO Timeline.
 func (d *Decoder) Decode() (*gotio.Timeline, error) {
+	d.adjustments = nil
+
 	events, err := d.parseEvents()
 	if err != nil {
 		return nil, err
 	}
 
+	// Record placement is rebuilt from the source durations and the
+	// previous cuts
+	if d.ignoreTimecodeMismatch {
+		events = d.inferRecordRanges(events)
+	}
+
+	if len(events) > 0 && !slices.ContainsFunc(events, func(event EDLEvent) bool {
+		return !d.isResolveMarkerEvent(event)
+	}) {
+		return d.markersToTimeline(events)
+	}
 	return d.eventsToTimeline(events)
 }
 
-// parseEvents reads all events from the EDL.
-func (d *Decoder) parseEvents() ([]EDLEvent, error) {
-	scanner := bufio.NewScanner(d.r)
-	var events []EDLEvent
-	var currentEvent *EDLEvent
-	lineNum := 0
+// resolveMarkerReel is the reel of the events of a DaVinci Resolve marker list.
+const resolveMarkerReel = "001"
 
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
+// isResolveMarkerEvent reports whether an event is one of those DaVinci
+// Resolve writes for each timeline marker when exporting markers only: a one
+// frame cut on reel 001 carrying a Resolve marker line.
+func (d *Decoder) isResolveMarkerEvent(event EDLEvent) bool {
+	if event.ReelName != resolveMarkerReel || event.EditType != EditTypeCut || event.Outgoing != nil || len(event.Markers) != 1 {
+		return false
+	}
+	if !slices.ContainsFunc(event.CommentLines, resolveMarkerRegex.MatchString) {
+		return false
+	}
+	_, _, recordIn, recordOut, err := d.eventTimes(event)
+	return err == nil && math.Round(recordOut.Sub(recordIn).Value()) == 1
+}
 
-		// Skip blank lines
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
+// markersToTimeline converts the events of a DaVinci Resolve marker list to
+// a timeline holding their markers. The markers are placed by record time on
+// a video track, which holds a gap up to the end of the last event.
+func (d *Decoder) markersToTimeline(events []EDLEvent) (*gotio.Timeline, error) {
+	metadata := make(map[string]interface{})
+	if len(d.headerComments) > 0 {
+		metadata["header_comments"] = d.headerComments
+	}
 
-		// Check for title line
-		if strings.HasPrefix(strings.TrimSpace(line), "TITLE:") {
-			continue
-		}
+	start := d.recordStart(events)
+	timeline := gotio.NewTimeline(d.title, &start, metadata)
 
-		// Check for FCM (frame count mode) line
-		if strings.HasPrefix(strings.TrimSpace(line), "FCM:") {
-			// Parse FCM mode (DROP FRAME or NON-DROP FRAME)
-			parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
-			if len(parts) == 2 {
-				d.fcmMode = strings.TrimSpace(parts[1])
-			}
-			continue
+	trackMetadata := map[string]interface{}{
+		"cmx_3600": map[string]interface{}{
+			"track_type": string(TrackTypeVideo),
+			"layer":      1,
+		},
+	}
+	track := gotio.NewTrack(d.trackNamer(TrackTypeVideo, 1), nil, gotio.TrackKindVideo, trackMetadata, nil)
+
+	var markers []*gotio.Marker
+	end := start
+	for _, event := range events {
+		_, _, recordIn, recordOut, err := d.eventTimes(event)
+		if err != nil {
+			return nil, eventError(event, err)
+		}
+		marker := event.Markers[0]
+		markedRange := opentime.NewTimeRange(recordIn.Sub(start), opentime.NewRationalTime(float64(marker.Duration), d.rate))
+		markers = append(markers, createMarker(marker, markedRange))
+		if recordOut.Value() > end.Value() {
+			end = recordOut
 		}
+	}
 
-		// Try to match event line
-		if matches := eventLineRegex.FindStringSubmatch(line); matches != nil {
-			// Save previous event if exists
-			if currentEvent != nil {
-				events = append(events, *currentEvent)
-			}
+	if err := track.AppendChild(gotio.NewGapWithDuration(end.Sub(start))); err != nil {
+		return nil, err
+	}
+	track.SetMarkers(markers)
+	if err := timeline.Tracks().AppendChild(track); err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
 
-			// Parse event number
-			eventNum, _ := strconv.Atoi(matches[1])
+// parseEvents reads all events from the EDL. Each event is checked as it is
+// read, so that in strict mode decoding stops at the first problem in the
+// EDL, and the diagnostics are in the order their problems were found.
+func (d *Decoder) parseEvents() ([]EDLEvent, error) {
+	reader := NewEventReader(d.r)
+	reader.SetMode(d.mode)
+	d.diagnostics = nil
 
-			// Parse transition duration if present
-			transitionDuration := 0
-			if matches[5] != "" {
-				transitionDuration, _ = strconv.Atoi(matches[5])
-			}
+	var events []EDLEvent
+	var err error
+	read := 0 // Diagnostics of the reader added so far
+	for event, readErr := range reader.Events() {
+		d.diagnostics = append(d.diagnostics, reader.Diagnostics()[read:]...)
+		read = len(reader.Diagnostics())
+		if readErr != nil {
+			err = readErr
+			break
+		}
 
-			// Extract edit type and wipe code
-			editTypeStr := matches[4]
-			editType := EditType(editTypeStr)
-			wipeCode := ""
-			if len(editTypeStr) == 4 && editTypeStr[0] == 'W' {
-				// This is a wipe code (W###)
-				editType = EditTypeWipe
-				wipeCode = editTypeStr
-			}
+		checked, ok, checkErr := d.checkEvent(event)
+		if checkErr != nil {
+			err = checkErr
+			break
+		}
+		if ok {
+			events = append(events, checked)
+		}
+	}
 
-			currentEvent = &EDLEvent{
-				EventNumber:        eventNum,
-				ReelName:           matches[2],
-				TrackType:          TrackType(matches[3]),
-				EditType:           editType,
-				TransitionDuration: transitionDuration,
-				WipeCode:           wipeCode,
-			}
+	d.diagnostics = append(d.diagnostics, reader.Diagnostics()[read:]...)
+	if err != nil {
+		return nil, err
+	}
 
-			// The next line should be timecodes
-			if scanner.Scan() {
-				lineNum++
-				tcLine := scanner.Text()
-				if tcMatches := timecodeLineRegex.FindStringSubmatch(tcLine); tcMatches != nil {
-					currentEvent.SourceIn = tcMatches[1]
-					currentEvent.SourceOut = tcMatches[2]
-					currentEvent.RecordIn = tcMatches[3]
-					currentEvent.RecordOut = tcMatches[4]
-				} else {
-					return nil, &ParseError{
-						Line:    lineNum,
-						Message: "expected timecode line after event",
-					}
-				}
-			}
-			continue
+	d.fcmMode = reader.FCM()
+	d.title = reader.Title()
+	d.headerComments = reader.HeaderComments()
+	return events, nil
+}
+
+// checkEvent reports an event with timecodes that cannot be parsed, an event
+// that plays an empty source range, and locators with timecodes that cannot
+// be parsed. Unless the problem is fatal in the decoder's mode, an event with
+// invalid timecodes is dropped, reporting false, and such locators removed.
+// An event with an empty source range is kept.
+func (d *Decoder) checkEvent(event EDLEvent) (EDLEvent, bool, error) {
+	_, _, _, _, err := d.eventTimes(event)
+	if err == nil && event.Outgoing != nil {
+		_, _, _, _, err = d.eventTimes(*event.Outgoing)
+	}
+	if err != nil {
+		if err := d.report(event, Diagnostic{
+			Line:     event.Line,
+			EndLine:  event.EndLine,
+			Severity: SeverityError,
+			Code:     DiagnosticInvalidTimecode,
+			Message:  err.Error(),
+		}); err != nil {
+			return EDLEvent{}, false, err
 		}
+		return EDLEvent{}, false, nil
+	}
 
-		// Check for M2 speed effect lines
-		if strings.HasPrefix(strings.TrimSpace(line), "M2") {
-			if currentEvent != nil && speedEffectRegex.MatchString(line) {
-				matches := speedEffectRegex.FindStringSubmatch(line)
-				if len(matches) == 4 {
-					speed, _ := strconv.ParseFloat(matches[2], 64)
-					currentEvent.SpeedEffect = &SpeedEffect{
-						Name:     matches[1],
-						Speed:    speed,
-						Timecode: matches[3],
-					}
-				}
-			}
-			continue
+	if d.emptySource(event) {
+		if err := d.report(event, Diagnostic{
+			Line:     event.Line,
+			EndLine:  event.EndLine,
+			Severity: SeverityWarning,
+			Code:     DiagnosticInvalidSourceRange,
+			Message:  fmt.Sprintf("empty source range %s-%s for record range %s-%s", event.SourceIn, event.SourceOut, event.RecordIn, event.RecordOut),
+		}); err != nil {
+			return EDLEvent{}, false, err
 		}
+	}
 
-		// Check for comment lines
-		if currentEvent != nil {
-			trimmed := strings.TrimSpace(line)
-
-			// FROM CLIP NAME: indicates the clip name
-			// Handle both "*FROM CLIP NAME:" and "* FROM CLIP NAME:"
-			if strings.HasPrefix(trimmed, "*FROM CLIP NAME:") {
-				currentEvent.ClipName = strings.TrimSpace(strings.TrimPrefix(trimmed, "*FROM CLIP NAME:"))
-			} else if strings.HasPrefix(trimmed, "* FROM CLIP NAME:") {
-				currentEvent.ClipName = strings.TrimSpace(strings.TrimPrefix(trimmed, "* FROM CLIP NAME:"))
-			} else if strings.HasPrefix(trimmed, "*FROM CLIP:") {
-				// FROM CLIP: for Avid style - file path
-				currentEvent.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "*FROM CLIP:"))
-			} else if strings.HasPrefix(trimmed, "* FROM CLIP:") {
-				currentEvent.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "* FROM CLIP:"))
-			} else if strings.HasPrefix(trimmed, "*FROM FILE:") {
-				// FROM FILE: for Nucoda style - file path
-				currentEvent.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "*FROM FILE:"))
-			} else if strings.HasPrefix(trimmed, "* FROM FILE:") {
-				currentEvent.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "* FROM FILE:"))
-			} else if strings.HasPrefix(trimmed, "* FREEZE FRAME") || strings.HasSuffix(trimmed, " FF") {
-				// Freeze frame detection
-				currentEvent.FreezeFrame = true
-			} else if markerRegex.MatchString(trimmed) {
-				// Locator/marker
-				matches := markerRegex.FindStringSubmatch(trimmed)
-				if len(matches) == 5 {
-					marker := Marker{
-						Timecode: matches[1],
-						Color:    matches[2],
-						Comment:  strings.TrimSpace(matches[4]),
-					}
-					currentEvent.Markers = append(currentEvent.Markers, marker)
-				}
-			} else if ascSOPRegex.MatchString(trimmed) {
-				// ASC_SOP color correction
-				matches := ascSOPRegex.FindStringSubmatch(trimmed)
-				if len(matches) == 10 {
-					if currentEvent.ASCCDL == nil {
-						currentEvent.ASCCDL = &ASCCDL{}
-					}
-					for i := 0; i < 3; i++ {
-						currentEvent.ASCCDL.Slope[i], _ = strconv.ParseFloat(matches[1+i], 64)
-						currentEvent.ASCCDL.Offset[i], _ = strconv.ParseFloat(matches[4+i], 64)
-						currentEvent.ASCCDL.Power[i], _ = strconv.ParseFloat(matches[7+i], 64)
-					}
-				}
-			} else if ascSATRegex.MatchString(trimmed) {
-				// ASC_SAT saturation
-				matches := ascSATRegex.FindStringSubmatch(trimmed)
-				if len(matches) == 2 {
-					if currentEvent.ASCCDL == nil {
-						currentEvent.ASCCDL = &ASCCDL{}
-					}
-					currentEvent.ASCCDL.Saturation, _ = strconv.ParseFloat(matches[1], 64)
-				}
-			} else if strings.HasPrefix(trimmed, "*") {
-				// Other comments
-				if currentEvent.Comment != "" {
-					currentEvent.Comment += "\n"
-				}
-				currentEvent.Comment += trimmed
+	var markers []Marker
+	for _, marker := range event.Markers {
+		if _, err := fromTimecode(marker.Timecode, d.rate, event.DropFrame); err != nil {
+			if err := d.report(event, Diagnostic{
+				Line:     event.Line,
+				EndLine:  event.EndLine,
+				Severity: SeverityWarning,
+				Code:     DiagnosticInvalidMarker,
+				Message:  fmt.Sprintf("invalid marker timecode '%s': %v", marker.Timecode, err),
+			}); err != nil {
+				return EDLEvent{}, false, err
 			}
+			continue
 		}
+		markers = append(markers, marker)
 	}
+	event.Markers = markers
 
-	// Save last event
-	if currentEvent != nil {
-		events = append(events, *currentEvent)
-	}
+	return event, true, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// emptySource reports whether an event has an empty source range but not an
+// empty record range, without an M2 line or freeze frame comment to hold a
+// frame for it.
+func (d *Decoder) emptySource(event EDLEvent) bool {
+	if event.SpeedEffect != nil || event.FreezeFrame {
+		return false
+	}
+	sourceIn, sourceOut, recordIn, recordOut, err := d.eventTimes(event)
+	if err != nil {
+		return false
 	}
+	return math.Round(sourceOut.Sub(sourceIn).Value()) == 0 && math.Round(recordOut.Sub(recordIn).Value()) > 0
+}
 
-	return events, nil
+// report records a diagnostic for an event. It returns a *ParseError giving
+// the lines of the event if the problem is fatal in the decoder's mode.
+func (d *Decoder) report(event EDLEvent, diagnostic Diagnostic) error {
+	d.diagnostics = append(d.diagnostics, diagnostic)
+	if diagnostic.check(d.mode) != nil {
+		return &ParseError{Line: event.Line, EndLine: event.EndLine, Message: diagnostic.Message}
+	}
+	return nil
 }
 
 // eventsToTimeline converts parsed events to an OpenTimelineIO Timeline.
 func (d *Decoder) eventsToTimeline(events []EDLEvent) (*gotio.Timeline, error) {
-	timeline := gotio.NewTimeline("", nil, nil)
+	metadata := make(map[string]interface{})
+	if len(d.headerComments) > 0 {
+		metadata["header_comments"] = d.headerComments
+	}
+
+	// All tracks are laid out from the earliest record in, so that
+	// layered tracks line up with the tracks below them. The earliest
+	// record in becomes the timeline's global start time.
+	start := d.recordStart(events)
+	var globalStart *opentime.RationalTime
+	if start.IsValidTime() {
+		globalStart = &start
+	}
+
+	timeline := gotio.NewTimeline(d.title, globalStart, metadata)
 	tracks := timeline.Tracks()
 
-	// Group events by track type
+	// Group events by channel, so an event on several channels is added to
+	// each of their tracks. Key foreground events go on a separate video
+	// track that is layered over their background.
 	trackMap := make(map[TrackType][]EDLEvent)
+	keyMap := make(map[TrackType][]EDLEvent)
 	for _, event := range events {
-		trackMap[event.TrackType] = append(trackMap[event.TrackType], event)
+		for _, trackType := range event.Channels.TrackTypes() {
+			if !event.EditType.IsKey() || !trackType.IsVideoTrack() {
+				trackMap[trackType] = append(trackMap[trackType], event)
+				continue
+			}
+			if event.Outgoing != nil {
+				trackMap[trackType] = append(trackMap[trackType], *event.Outgoing)
+			}
+			keyMap[trackType] = append(keyMap[trackType], event)
+		}
+	}
+
+	// Overlapping events are placed on additional layers, each following
+	// the layers below it in track order. Key foregrounds go on layers
+	// above those, on tracks above all other tracks. Track types the track
+	// order ranks the same are kept in the default order, so that the
+	// tracks come out the same from one decode to the next.
+	var layers, keyLayers []trackLayer
+	baseLayers := make(map[TrackType]int)
+	for _, trackType := range slices.SortedFunc(maps.Keys(trackMap), CompareTrackTypes) {
+		for i, layer := range d.layerEvents(trackMap[trackType]) {
+			layers = append(layers, trackLayer{trackType: trackType, layer: i + 1, events: layer})
+			baseLayers[trackType]++
+		}
+	}
+	for _, trackType := range slices.SortedFunc(maps.Keys(keyMap), CompareTrackTypes) {
+		base := max(baseLayers[trackType], 1)
+		for i, layer := range d.layerEvents(keyMap[trackType]) {
+			keyLayers = append(keyLayers, trackLayer{trackType: trackType, layer: base + i + 1, events: layer})
+		}
 	}
+	compare := func(a, b trackLayer) int {
+		if order := d.trackOrder(a.trackType, b.trackType); order != 0 {
+			return order
+		}
+		if order := CompareTrackTypes(a.trackType, b.trackType); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.layer, b.layer)
+	}
+	slices.SortStableFunc(layers, compare)
+	slices.SortStableFunc(keyLayers, compare)
 
-	// Create tracks
-	for trackType, trackEvents := range trackMap {
-		track, err := d.createTrack(trackType, trackEvents)
+	for _, layer := range append(layers, keyLayers...) {
+		track, err := d.createTrack(layer, start)
 		if err != nil {
 			return nil, err
 		}
@@ -279,215 +405,714 @@ func (d *Decoder) eventsToTimeline(events []EDLEvent) (*gotio.Timeline, error) {
 	return timeline, nil
 }
 
-// createTrack creates a track from a list of events.
-func (d *Decoder) createTrack(trackType TrackType, events []EDLEvent) (*gotio.Track, error) {
+// trackLayer holds the events of one layer of a track type.
+type trackLayer struct {
+	trackType TrackType
+	layer     int // Layer number, starting at 1
+	events    []EDLEvent
+}
+
+// layerEvents sorts events by record in and splits them into layers, so
+// that the record ranges of the events on each layer do not overlap. Each
+// event goes on the lowest layer it fits on. When timecode mismatches are
+// ignored, overlaps of up to maxRecordDrift frames are treated as drift, not
+// as layered events.
+func (d *Decoder) layerEvents(events []EDLEvent) [][]EDLEvent {
+	if len(events) == 0 {
+		return nil
+	}
+
+	type eventSpan struct {
+		event               EDLEvent
+		recordIn, recordOut float64
+	}
+	spans := make([]eventSpan, len(events))
+	for i, event := range events {
+		spans[i].event = event
+		_, _, recordIn, recordOut, err := d.eventTimes(event)
+		if err != nil {
+			// Reported when the track is created
+			continue
+		}
+		if isTransitionEvent(event) && event.Outgoing != nil {
+			if _, _, outRecordIn, _, err := d.eventTimes(*event.Outgoing); err == nil {
+				recordIn = outRecordIn
+			}
+		}
+		spans[i].recordIn = recordIn.Value()
+		spans[i].recordOut = recordOut.Value()
+	}
+	slices.SortStableFunc(spans, func(a, b eventSpan) int {
+		return cmp.Compare(a.recordIn, b.recordIn)
+	})
+
+	tolerance := 0.5 // Allow for rounding errors
+	if d.ignoreTimecodeMismatch {
+		tolerance += maxRecordDrift
+	}
+
+	var layers [][]EDLEvent
+	var layerEnds []float64
+	for _, span := range spans {
+		layer := slices.IndexFunc(layerEnds, func(end float64) bool {
+			return span.recordIn > end-tolerance
+		})
+		if layer < 0 {
+			layers = append(layers, nil)
+			layerEnds = append(layerEnds, span.recordOut)
+			layer = len(layers) - 1
+		}
+		layers[layer] = append(layers[layer], span.event)
+		layerEnds[layer] = max(layerEnds[layer], span.recordOut)
+	}
+	return layers
+}
+
+// recordStart returns the earliest record in of the events, or an invalid
+// time if there are none. Events with invalid timecodes are skipped here and
+// reported when their track is created.
+func (d *Decoder) recordStart(events []EDLEvent) opentime.RationalTime {
+	var start opentime.RationalTime
+	for _, event := range events {
+		recordIn, err := fromTimecode(event.RecordIn, d.rate, event.DropFrame)
+		if err != nil {
+			continue
+		}
+		if !start.IsValidTime() || recordIn.Value() < start.Value() {
+			start = recordIn
+		}
+	}
+	return start
+}
+
+// createTrack creates the track of a layer of events. The track starts at
+// the record time start, with a leading gap if its first event starts later.
+func (d *Decoder) createTrack(layer trackLayer, start opentime.RationalTime) (*gotio.Track, error) {
+	trackType, events := layer.trackType, layer.events
 	kind := gotio.TrackKindVideo
 	if trackType.IsAudioTrack() {
 		kind = gotio.TrackKindAudio
 	}
 
-	track := gotio.NewTrack(string(trackType), nil, kind, nil, nil)
-
-	// Sort events by event number (should already be sorted)
-	// For now, assume they are in order
+	// The track type and layer let the encoder write the events back on
+	// their channel, whatever the track is named
+	metadata := map[string]interface{}{
+		"cmx_3600": map[string]interface{}{
+			"track_type": string(trackType),
+			"layer":      layer.layer,
+		},
+	}
+	track := gotio.NewTrack(d.trackNamer(trackType, layer.layer), nil, kind, metadata, nil)
 
-	var lastRecordOut opentime.RationalTime
+	lastRecordOut := start
+	builder := &trackBuilder{d: d, track: track}
 
 	for _, event := range events {
-		// Parse timecodes
-		sourceIn, err := opentime.FromTimecode(event.SourceIn, d.rate)
+		sourceIn, sourceOut, recordIn, recordOut, err := d.eventTimes(event)
 		if err != nil {
-			return nil, fmt.Errorf("invalid source in timecode '%s': %w", event.SourceIn, err)
+			return nil, eventError(event, err)
 		}
 
-		sourceOut, err := opentime.FromTimecode(event.SourceOut, d.rate)
-		if err != nil {
-			return nil, fmt.Errorf("invalid source out timecode '%s': %w", event.SourceOut, err)
+		sourceRange := d.clipSourceRange(event, sourceIn, sourceOut, recordIn, recordOut)
+
+		if !isTransitionEvent(event) {
+			if err := builder.appendGap(lastRecordOut, recordIn); err != nil {
+				return nil, eventError(event, err)
+			}
+			if err := builder.hold(event, sourceRange); err != nil {
+				return nil, eventError(event, err)
+			}
+			lastRecordOut = recordOut
+			continue
 		}
 
-		recordIn, err := opentime.FromTimecode(event.RecordIn, d.rate)
-		if err != nil {
-			return nil, fmt.Errorf("invalid record in timecode '%s': %w", event.RecordIn, err)
+		// A dissolve or wipe starts at the incoming event's record in and the
+		// cut point is placed at its centre. The outgoing clip is extended up
+		// to the cut point and the incoming clip starts there.
+		duration := float64(event.TransitionDuration)
+		inOffset := opentime.NewRationalTime(math.Floor(duration/2), d.rate)
+		outOffset := opentime.NewRationalTime(duration-inOffset.Value(), d.rate)
+
+		outgoing := event.Outgoing
+		if outgoing == nil {
+			// Single line transitions take the previous event as the
+			// outgoing side, or fade up from black at the start of a track
+			outgoing = &EDLEvent{
+				EventNumber: event.EventNumber,
+				Line:        event.Line,
+				EndLine:     event.EndLine,
+				ReelName:    d.generators.BlackReel(),
+				TrackType:   event.TrackType,
+				EditType:    EditTypeCut,
+				SourceIn:    "00:00:00:00",
+				SourceOut:   "00:00:00:00",
+				RecordIn:    event.RecordIn,
+				RecordOut:   event.RecordIn,
+				DropFrame:   event.DropFrame,
+			}
 		}
 
-		recordOut, err := opentime.FromTimecode(event.RecordOut, d.rate)
+		outSourceIn, outSourceOut, outRecordIn, outRecordOut, err := d.eventTimes(*outgoing)
 		if err != nil {
-			return nil, fmt.Errorf("invalid record out timecode '%s': %w", event.RecordOut, err)
-		}
-
-		// Check for gaps in the timeline
-		if lastRecordOut.IsValidTime() {
-			gap := recordIn.Sub(lastRecordOut)
-			if gap.Value() > 0.5 { // Allow for rounding errors
-				// Insert a gap
-				gapDuration := gap
-				gapItem := gotio.NewGapWithDuration(gapDuration)
-				if err := track.AppendChild(gapItem); err != nil {
-					return nil, err
-				}
-			}
+			return nil, eventError(*outgoing, err)
 		}
+		outRange := d.clipSourceRange(*outgoing, outSourceIn, outSourceOut, outRecordIn, outRecordOut)
 
-		// Source range
-		sourceDuration := opentime.DurationFromStartEndTime(sourceIn, sourceOut)
-		sourceRange := opentime.NewTimeRange(sourceIn, sourceDuration)
-
-		// Create media reference based on reel name
-		var mediaRef gotio.MediaReference
-
-		// Check for generator references (BLACK, BL, BARS)
-		reelUpper := strings.ToUpper(event.ReelName)
-		if reelUpper == "BLACK" || reelUpper == "BL" {
-			genRef := gotio.NewGeneratorReference(
-				"black",
-				"black",
-				nil,
-				&sourceRange,
-				nil,
-			)
-			mediaRef = genRef
-		} else if reelUpper == "BARS" {
-			genRef := gotio.NewGeneratorReference(
-				"SMPTEBars",
-				"SMPTEBars",
-				nil,
-				&sourceRange,
-				nil,
-			)
-			mediaRef = genRef
-		} else {
-			// Use file path from comment if available, otherwise use reel name
-			targetURL := event.ReelName
-			if event.FilePath != "" {
-				targetURL = event.FilePath
+		// A zero length outgoing line continues the previous clip when the
+		// two are adjacent; otherwise the outgoing side gets its own clip.
+		adjacent := lastRecordOut.IsValidTime() && math.Abs(recordIn.Sub(lastRecordOut).Value()) < 0.5
+		if builder.pending == nil || outRange.Duration().Value() > 0 || !adjacent {
+			if err := builder.appendGap(lastRecordOut, outRecordIn); err != nil {
+				return nil, eventError(event, err)
+			}
+			if err := builder.hold(*outgoing, outRange); err != nil {
+				return nil, eventError(event, err)
 			}
-			mediaRef = gotio.NewExternalReference(
-				targetURL,
-				targetURL,
-				&sourceRange,
-				nil,
-			)
+			lastRecordOut = outRecordOut
 		}
 
-		// Use clip name from comment if available, otherwise use reel name
-		clipName := event.ClipName
-		if clipName == "" {
-			clipName = event.ReelName
+		builder.extend(inOffset)
+		if err := builder.flush(); err != nil {
+			return nil, eventError(event, err)
 		}
 
-		// Strip " FF" suffix if freeze frame detected
-		if event.FreezeFrame && strings.HasSuffix(clipName, " FF") {
-			clipName = clipName[:len(clipName)-3]
+		if err := track.AppendChild(d.createTransition(event, inOffset, outOffset)); err != nil {
+			return nil, eventError(event, err)
 		}
 
-		// Create metadata for CDL and other info
-		metadata := make(map[string]interface{})
-		if event.ASCCDL != nil {
-			metadata["cdl"] = map[string]interface{}{
-				"slope":      event.ASCCDL.Slope,
-				"offset":     event.ASCCDL.Offset,
-				"power":      event.ASCCDL.Power,
-				"saturation": event.ASCCDL.Saturation,
-			}
-		}
-		if event.WipeCode != "" {
-			metadata["wipe_code"] = event.WipeCode
+		incomingRange := opentime.NewTimeRange(sourceRange.StartTime().Add(inOffset), sourceRange.Duration().Sub(inOffset))
+		if err := builder.hold(event, incomingRange); err != nil {
+			return nil, eventError(event, err)
 		}
+		lastRecordOut = recordOut
+	}
+
+	if err := builder.flush(); err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
 
-		// Build effects list
-		var effects []gotio.Effect
+// trackBuilder appends decoded events to a track. The most recent clip is
+// held back until the next event is known, since a following dissolve or
+// wipe extends its source range.
+type trackBuilder struct {
+	d       *Decoder
+	track   *gotio.Track
+	pending *pendingClip
+}
+
+// pendingClip is a decoded event whose clip has not been added to its track yet.
+type pendingClip struct {
+	event       EDLEvent
+	sourceRange opentime.TimeRange
+}
+
+// hold appends the pending clip, if any, and holds back a clip for event.
+func (b *trackBuilder) hold(event EDLEvent, sourceRange opentime.TimeRange) error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	b.pending = &pendingClip{event: event, sourceRange: sourceRange}
+	return nil
+}
 
-		// Add speed effects
-		if event.SpeedEffect != nil {
-			// Create LinearTimeWarp effect
-			timeScalar := event.SpeedEffect.Speed / d.rate
-			effect := gotio.NewLinearTimeWarp(
-				"",
-				"LinearTimeWarp",
-				timeScalar,
-				nil,
-			)
-			effects = append(effects, effect)
+// extend lengthens the source range of the pending clip by duration.
+func (b *trackBuilder) extend(duration opentime.RationalTime) {
+	if b.pending == nil {
+		return
+	}
+	b.pending.sourceRange = opentime.NewTimeRange(
+		b.pending.sourceRange.StartTime(),
+		b.pending.sourceRange.Duration().Add(duration),
+	)
+}
+
+// flush appends the pending clip, if any, to the track.
+func (b *trackBuilder) flush() error {
+	if b.pending == nil {
+		return nil
+	}
+	event := b.pending.event
+	clip := b.d.createClip(event, b.pending.sourceRange)
+	b.pending = nil
+	if err := b.track.AppendChild(clip); err != nil {
+		return eventError(event, err)
+	}
+	return nil
+}
+
+// appendGap adds a gap to the track if recordIn starts after lastRecordOut.
+// Any pending clip is appended first.
+func (b *trackBuilder) appendGap(lastRecordOut, recordIn opentime.RationalTime) error {
+	if !lastRecordOut.IsValidTime() {
+		return nil
+	}
+
+	gap := recordIn.Sub(lastRecordOut)
+	if gap.Value() <= 0.5 { // Allow for rounding errors
+		return nil
+	}
+
+	if err := b.flush(); err != nil {
+		return err
+	}
+	return b.track.AppendChild(gotio.NewGapWithDuration(gap))
+}
+
+// isTransitionEvent reports whether an event is a dissolve or wipe.
+func isTransitionEvent(event EDLEvent) bool {
+	return (event.EditType == EditTypeDissolve || event.EditType == EditTypeWipe) && event.TransitionDuration > 0
+}
+
+// timeScalar returns the playback speed of an event's source relative to
+// its record range, and whether the event is retimed at all. Negative speeds
+// play the source in reverse and a speed of zero holds a frame. Only an M2
+// line or freeze frame comment holds a frame; an empty source range is not
+// fit to fill its record range.
+func (d *Decoder) timeScalar(event EDLEvent) (float64, bool) {
+	if event.FreezeFrame {
+		return 0, true
+	}
+	if event.SpeedEffect != nil {
+		return event.SpeedEffect.Speed / d.rate, true
+	}
+
+	// Mismatched durations are corrected rather than fit to fill when
+	// timecode mismatches are ignored
+	if d.ignoreTimecodeMismatch {
+		return 1, false
+	}
+	sourceIn, sourceOut, recordIn, recordOut, err := d.eventTimes(event)
+	if err != nil {
+		return 1, false
+	}
+	sourceDuration := opentime.DurationFromStartEndTime(sourceIn, sourceOut).Value()
+	recordDuration := opentime.DurationFromStartEndTime(recordIn, recordOut).Value()
+	if recordDuration <= 0 || math.Abs(sourceDuration) < 0.5 || math.Abs(sourceDuration-recordDuration) < 0.5 {
+		return 1, false
+	}
+	return sourceDuration / recordDuration, true
+}
+
+// clipSourceRange returns the source range of the clip for an event. A
+// retimed clip lasts for its record range, starting from the source
+// timecode of its M2 line, if any.
+func (d *Decoder) clipSourceRange(event EDLEvent, sourceIn, sourceOut, recordIn, recordOut opentime.RationalTime) opentime.TimeRange {
+	if _, retimed := d.timeScalar(event); !retimed {
+		// An empty source range is played from its source in for the
+		// record range, so that the event keeps its place on the track
+		duration := opentime.DurationFromStartEndTime(sourceIn, sourceOut)
+		if math.Abs(duration.Value()) < 0.5 {
+			duration = opentime.DurationFromStartEndTime(recordIn, recordOut)
 		}
+		return opentime.NewTimeRange(sourceIn, duration)
+	}
 
-		// Add freeze frame effect
-		if event.FreezeFrame {
-			effect := gotio.NewFreezeFrame("", nil)
-			effects = append(effects, effect)
+	start := sourceIn
+	if event.SpeedEffect != nil {
+		if entry, err := fromTimecode(event.SpeedEffect.Timecode, d.rate, event.DropFrame); err == nil {
+			start = entry
 		}
+	}
+	return opentime.NewTimeRange(start, opentime.DurationFromStartEndTime(recordIn, recordOut))
+}
 
-		// Build markers list
-		var markers []*gotio.Marker
-		for _, marker := range event.Markers {
-			markerTC, err := opentime.FromTimecode(marker.Timecode, d.rate)
-			if err != nil {
-				continue // Skip invalid marker timecodes
-			}
-			markerRange := opentime.NewTimeRange(markerTC, opentime.NewRationalTime(0, d.rate))
+// eventError wraps an error decoding an event in a *ParseError giving the
+// lines of the event. Errors that already give their lines are returned
+// unchanged.
+func eventError(event EDLEvent, err error) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return err
+	}
+	return &ParseError{Line: event.Line, EndLine: event.EndLine, Message: err.Error(), Err: err}
+}
 
-			markerMeta := make(map[string]interface{})
-			if marker.Color != "" {
-				markerMeta["color"] = marker.Color
-			}
+// eventTimes parses the source and record timecodes of an event.
+func (d *Decoder) eventTimes(event EDLEvent) (sourceIn, sourceOut, recordIn, recordOut opentime.RationalTime, err error) {
+	sourceIn, err = fromTimecode(event.SourceIn, d.rate, event.DropFrame)
+	if err != nil {
+		err = fmt.Errorf("invalid source in timecode '%s': %w", event.SourceIn, err)
+		return
+	}
+
+	sourceOut, err = fromTimecode(event.SourceOut, d.rate, event.DropFrame)
+	if err != nil {
+		err = fmt.Errorf("invalid source out timecode '%s': %w", event.SourceOut, err)
+		return
+	}
+
+	recordIn, err = fromTimecode(event.RecordIn, d.rate, event.DropFrame)
+	if err != nil {
+		err = fmt.Errorf("invalid record in timecode '%s': %w", event.RecordIn, err)
+		return
+	}
 
-			// Convert color string to MarkerColor
-			markerColor := gotio.MarkerColor(marker.Color)
+	recordOut, err = fromTimecode(event.RecordOut, d.rate, event.DropFrame)
+	if err != nil {
+		err = fmt.Errorf("invalid record out timecode '%s': %w", event.RecordOut, err)
+		return
+	}
 
-			otioMarker := gotio.NewMarker(
-				marker.Comment,
-				markerRange,
-				markerColor,
-				marker.Comment,
-				markerMeta,
-			)
-			markers = append(markers, otioMarker)
+	return
+}
+
+// createTransition creates the transition for a dissolve or wipe event.
+func (d *Decoder) createTransition(event EDLEvent, inOffset, outOffset opentime.RationalTime) *gotio.Transition {
+	transitionType := gotio.TransitionTypeSMPTEDissolve
+	transitionName := ""
+	if event.EditType == EditTypeWipe {
+		// For wipes, use custom transition type and include wipe code in name
+		transitionType = gotio.TransitionTypeCustom
+		if event.WipeCode != "" {
+			transitionName = event.WipeCode
+		} else {
+			transitionName = "SMPTE_Wipe"
 		}
+	}
+
+	return gotio.NewTransition(
+		transitionName,
+		transitionType,
+		inOffset,
+		outOffset,
+		nil,
+	)
+}
 
-		// Create clip
-		clip := gotio.NewClip(
-			clipName,
-			mediaRef,
+// createClip creates a clip for an event with the given source range.
+func (d *Decoder) createClip(event EDLEvent, sourceRange opentime.TimeRange) *gotio.Clip {
+	// Create media reference based on reel name
+	var mediaRef gotio.MediaReference
+
+	// Check for generator references (BL, BARS, SLUG, ...). Auxiliary
+	// sources have media, and are read as any other reel
+	if generator, ok := d.generators.Lookup(event.ReelName); ok && generator.Kind != "" {
+		genRef := gotio.NewGeneratorReference(
+			generator.Kind,
+			generator.Kind,
+			nil,
 			&sourceRange,
-			metadata,
-			effects,
-			markers,
-			"",
 			nil,
 		)
+		mediaRef = genRef
+	} else {
+		// Use file path from comment if available, otherwise use reel name
+		targetURL := event.ReelName
+		if event.FilePath != "" {
+			targetURL = event.FilePath
+		}
+		mediaRef = gotio.NewExternalReference(
+			targetURL,
+			targetURL,
+			&sourceRange,
+			nil,
+		)
+	}
 
-		// Handle transitions
-		if (event.EditType == EditTypeDissolve || event.EditType == EditTypeWipe) && event.TransitionDuration > 0 {
-			// Create a transition
-			transitionDuration := opentime.NewRationalTime(float64(event.TransitionDuration), d.rate)
-			transitionType := gotio.TransitionTypeSMPTEDissolve
-			transitionName := ""
-			if event.EditType == EditTypeWipe {
-				// For wipes, use custom transition type and include wipe code in name
-				transitionType = gotio.TransitionTypeCustom
-				if event.WipeCode != "" {
-					transitionName = event.WipeCode
-				} else {
-					transitionName = "SMPTE_Wipe"
-				}
+	// Use clip name from comment if available, otherwise use reel name
+	clipName := event.ClipName
+	if clipName == "" {
+		clipName = event.ReelName
+	}
+
+	// Strip " FF" suffix if freeze frame detected
+	if event.FreezeFrame && strings.HasSuffix(clipName, " FF") {
+		clipName = clipName[:len(clipName)-3]
+	}
+
+	// Create metadata for CDL and other info
+	metadata := make(map[string]interface{})
+	if event.ASCCDL != nil {
+		metadata["cdl"] = map[string]interface{}{
+			"slope":      event.ASCCDL.Slope,
+			"offset":     event.ASCCDL.Offset,
+			"power":      event.ASCCDL.Power,
+			"saturation": event.ASCCDL.Saturation,
+		}
+	}
+	if event.WipeCode != "" {
+		metadata["wipe_code"] = event.WipeCode
+	}
+	if trackTypes := event.Channels.TrackTypes(); len(trackTypes) > 1 {
+		// Clips decoded from the same multi-channel event are linked
+		linkedTracks := make([]string, len(trackTypes))
+		for i, trackType := range trackTypes {
+			linkedTracks[i] = string(trackType)
+		}
+		metadata["link_id"] = fmt.Sprintf("%03d@%s", event.EventNumber, event.RecordIn)
+		metadata["linked_tracks"] = linkedTracks
+	}
+	// The event number and lines as written let the encoder write the
+	// event back unchanged
+	source := map[string]interface{}{
+		"event_number": event.EventNumber,
+		"reel":         event.ReelName,
+	}
+	if len(event.CommentLines) > 0 {
+		source["comments"] = event.CommentLines
+	}
+	if len(event.UnknownLines) > 0 {
+		source["unknown_lines"] = event.UnknownLines
+	}
+	if d.sourceLines && event.Line > 0 {
+		source["line"] = event.Line
+		source["end_line"] = event.EndLine
+	}
+	metadata["cmx_3600"] = source
+	if event.EditType.IsKey() {
+		metadata["key"] = map[string]interface{}{
+			"type":          string(event.EditType),
+			"fade_duration": event.TransitionDuration,
+		}
+	}
+
+	// Build effects list
+	var effects []gotio.Effect
+
+	// Add speed effects. A speed of zero is a freeze frame, and an event
+	// without an M2 line whose source and record durations differ is fit
+	// to fill its record range.
+	timeScalar, retimed := d.timeScalar(event)
+	if retimed && timeScalar == 0 {
+		effect := gotio.NewFreezeFrame("", nil)
+		effects = append(effects, effect)
+	} else if retimed {
+		name := ""
+		if event.SpeedEffect == nil {
+			name = "FitToFill"
+		}
+		effect := gotio.NewLinearTimeWarp(
+			name,
+			"LinearTimeWarp",
+			timeScalar,
+			nil,
+		)
+		effects = append(effects, effect)
+	}
+
+	// Build markers list
+	var markers []*gotio.Marker
+	for _, marker := range event.Markers {
+		markerTC, err := fromTimecode(marker.Timecode, d.rate, event.DropFrame)
+		if err != nil {
+			continue // Skip invalid marker timecodes
+		}
+		markerRange := opentime.NewTimeRange(markerTC, opentime.NewRationalTime(float64(marker.Duration), d.rate))
+		markers = append(markers, createMarker(marker, markerRange))
+	}
+
+	// Create clip
+	clip := gotio.NewClip(
+		clipName,
+		mediaRef,
+		&sourceRange,
+		metadata,
+		effects,
+		markers,
+		"",
+		nil,
+	)
+
+	return clip
+}
+
+// createMarker creates the marker for a locator marking markedRange. A
+// DaVinci Resolve colour is kept as "resolve_color" metadata, so that the
+// encoder can write it back in the Resolve style.
+func createMarker(marker Marker, markedRange opentime.TimeRange) *gotio.Marker {
+	metadata := make(map[string]interface{})
+	if marker.Color != "" {
+		metadata["color"] = marker.Color
+	}
+	if marker.ResolveColor != "" {
+		metadata["resolve_color"] = marker.ResolveColor
+	}
+
+	return gotio.NewMarker(
+		marker.Comment,
+		markedRange,
+		gotio.MarkerColor(marker.Color),
+		marker.Comment,
+		metadata,
+	)
+}
+
+// inferRecordRanges rebuilds the record ranges of events whose record
+// timecodes do not match their source. Each event is inferred once, in record
+// order, from the end of the channels it is on, so that the clips of an event
+// on several channels keep the same record range on every track. Key
+// foregrounds are inferred from the end of their key track. The first event
+// on a channel keeps its record in.
+func (d *Decoder) inferRecordRanges(events []EDLEvent) []EDLEvent {
+	recordIns := make([]float64, len(events))
+	for i, event := range events {
+		if recordIn, err := fromTimecode(event.RecordIn, d.rate, event.DropFrame); err == nil {
+			recordIns[i] = recordIn.Value()
+		}
+	}
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(recordIns[a], recordIns[b])
+	})
+
+	// The end of each channel is the latest record out on it, so that
+	// events layered over the channel do not move the events below
+	ends := make(map[string]opentime.RationalTime)
+	extend := func(channel string, recordOut opentime.RationalTime) {
+		if end, ok := ends[channel]; !ok || recordOut.Value() > end.Value() {
+			ends[channel] = recordOut
+		}
+	}
+
+	inferred := slices.Clone(events)
+	for _, i := range order {
+		event := &inferred[i]
+		sourceIn, sourceOut, recordIn, recordOut, err := d.eventTimes(*event)
+		if err != nil {
+			continue
+		}
+
+		var channels []string
+		for _, trackType := range event.Channels.TrackTypes() {
+			channel := string(trackType)
+			if event.EditType.IsKey() && trackType.IsVideoTrack() {
+				channel = "key " + channel
+			}
+			channels = append(channels, channel)
+		}
+
+		// The event follows the channel it is closest to
+		var previous opentime.RationalTime
+		for _, channel := range channels {
+			end, ok := ends[channel]
+			if ok && (!previous.IsValidTime() || math.Abs(recordIn.Sub(end).Value()) < math.Abs(recordIn.Sub(previous).Value())) {
+				previous = end
 			}
-			transition := gotio.NewTransition(
-				transitionName,
-				transitionType,
-				opentime.NewRationalTime(0, d.rate),
-				transitionDuration,
-				nil,
-			)
-			if err := track.AppendChild(transition); err != nil {
-				return nil, err
+		}
+
+		newRecordIn, newRecordOut := d.inferRecordRange(*event, sourceIn, sourceOut, recordIn, recordOut, previous)
+		if math.Round(newRecordIn.Sub(recordIn).Value()) != 0 || math.Round(newRecordOut.Sub(recordOut).Value()) != 0 {
+			event.RecordIn = eventTimecode(newRecordIn, d.rate, event.DropFrame)
+			event.RecordOut = eventTimecode(newRecordOut, d.rate, event.DropFrame)
+		}
+
+		for _, channel := range channels {
+			extend(channel, newRecordOut)
+		}
+		if event.Outgoing != nil {
+			if _, _, _, outRecordOut, err := d.eventTimes(*event.Outgoing); err == nil {
+				for _, trackType := range event.Channels.TrackTypes() {
+					extend(string(trackType), outRecordOut)
+				}
 			}
 		}
+	}
+	return inferred
+}
 
-		if err := track.AppendChild(clip); err != nil {
-			return nil, err
+// inferRecordRange rebuilds an event's record range from its source duration
+// and the record out of the event before it. Record ins that drift from the
+// previous record out by up to maxRecordDrift frames are snapped to it, and
+// the record out is recomputed from the source duration. Events with
+// motion effects keep their record duration, since it legitimately differs from
+// the source duration, as do events with an empty source range. Every change is recorded as a TimecodeAdjustment.
+func (d *Decoder) inferRecordRange(event EDLEvent, sourceIn, sourceOut, recordIn, recordOut, lastRecordOut opentime.RationalTime) (opentime.RationalTime, opentime.RationalTime) {
+	newRecordIn := recordIn
+	if lastRecordOut.IsValidTime() {
+		drift := math.Round(recordIn.Sub(lastRecordOut).Value())
+		if drift != 0 && math.Abs(drift) <= maxRecordDrift {
+			newRecordIn = lastRecordOut
 		}
+	}
 
-		lastRecordOut = recordOut
+	duration := opentime.DurationFromStartEndTime(sourceIn, sourceOut)
+	if event.SpeedEffect != nil || event.FreezeFrame || math.Abs(duration.Value()) < 0.5 {
+		duration = opentime.DurationFromStartEndTime(recordIn, recordOut)
 	}
+	newRecordOut := newRecordIn.Add(duration)
 
-	return track, nil
+	inDelta := int(math.Round(newRecordIn.Sub(recordIn).Value()))
+	outDelta := int(math.Round(newRecordOut.Sub(recordOut).Value()))
+	if inDelta != 0 || outDelta != 0 {
+		d.adjustments = append(d.adjustments, TimecodeAdjustment{
+			EventNumber:       event.EventNumber,
+			TrackType:         event.TrackType,
+			OriginalRecordIn:  event.RecordIn,
+			OriginalRecordOut: event.RecordOut,
+			RecordIn:          eventTimecode(newRecordIn, d.rate, event.DropFrame),
+			RecordOut:         eventTimecode(newRecordOut, d.rate, event.DropFrame),
+			RecordInDelta:     inDelta,
+			RecordOutDelta:    outDelta,
+		})
+	}
+
+	return newRecordIn, newRecordOut
+}
+
+// eventTimecode formats a RationalTime as a timecode string at the given rate,
+// counting frames the way fromTimecode reads them back.
+func eventTimecode(t opentime.RationalTime, rate float64, dropFrame bool) string {
+	drop := opentime.ForceNo
+	if dropFrame && isDropFrameRate(rate) {
+		drop = opentime.ForceYes
+	}
+	tc, err := t.RescaledTo(rate).ToTimecode(rate, drop)
+	if err != nil {
+		return "00:00:00:00"
+	}
+	return tc
+}
+
+// isDropFrameMode reports whether an FCM header value selects drop frame counting.
+func isDropFrameMode(mode string) bool {
+	return strings.EqualFold(strings.TrimSpace(mode), "DROP FRAME")
+}
+
+// fromTimecode parses a timecode string at the given rate. When dropFrame is
+// true and the rate is 29.97 or 59.94, the timecode is interpreted with SMPTE
+// drop frame counting, otherwise it is treated as non-drop frame.
+func fromTimecode(tc string, rate float64, dropFrame bool) (opentime.RationalTime, error) {
+	if !dropFrame || !isDropFrameRate(rate) {
+		return opentime.FromTimecode(strings.ReplaceAll(tc, ";", ":"), rate)
+	}
+
+	fields := strings.FieldsFunc(tc, func(r rune) bool {
+		return r == ':' || r == ';'
+	})
+	if len(fields) != 4 {
+		return opentime.RationalTime{}, fmt.Errorf("malformed drop frame timecode")
+	}
+
+	var parts [4]int
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 0 {
+			return opentime.RationalTime{}, fmt.Errorf("malformed drop frame timecode")
+		}
+		parts[i] = value
+	}
+	hours, minutes, seconds, frames := parts[0], parts[1], parts[2], parts[3]
+
+	// 29.97 drops two frame numbers per minute and 59.94 drops four,
+	// except for every tenth minute
+	nominalRate := int(math.Round(rate))
+	droppedFrames := nominalRate / 15
+	if minutes > 59 || seconds > 59 || frames >= nominalRate {
+		return opentime.RationalTime{}, fmt.Errorf("drop frame timecode out of range")
+	}
+	if seconds == 0 && frames < droppedFrames && minutes%10 != 0 {
+		return opentime.RationalTime{}, fmt.Errorf("frame number dropped in drop frame timecode")
+	}
+
+	totalMinutes := hours*60 + minutes
+	frameCount := (totalMinutes*60+seconds)*nominalRate + frames
+	frameCount -= droppedFrames * (totalMinutes - totalMinutes/10)
+
+	return opentime.NewRationalTime(float64(frameCount), rate), nil
 }
@@ -4,6 +4,9 @@
 package cmx3600
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
@@ -395,6 +398,8 @@ func TestDecoder_GeneratorReferences(t *testing.T) {
 		{"BLACK", "BLACK", "black"},
 		{"BL", "BL", "black"},
 		{"BARS", "BARS", "SMPTEBars"},
+		{"BLK", "BLK", "black"},
+		{"SLUG", "SLUG", "slug"},
 	}
 
 	for _, tt := range tests {
@@ -561,6 +566,48 @@ FCM: NON-DROP FRAME
 	}
 }
 
+func TestDecoder_ResolveMarkerList(t *testing.T) {
+	// DaVinci Resolve writes a marker list as one frame events on reel 001
+	edl := `TITLE: Timeline 1 Markers
+FCM: NON-DROP FRAME
+
+001  001      V     C        01:00:00:00 01:00:00:01 01:00:00:00 01:00:00:01
+ |C:ResolveColorBlue |M:Start |D:1
+
+002  001      V     C        01:00:05:00 01:00:05:01 01:00:05:00 01:00:05:01
+ |C:ResolveColorRose |M:Check focus |D:24
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 1 || len(timeline.AudioTracks()) != 0 {
+		t.Fatalf("Expected 1 video track, got %d video and %d audio tracks", len(videoTracks), len(timeline.AudioTracks()))
+	}
+	for _, child := range videoTracks[0].Children() {
+		if _, ok := child.(*gotio.Clip); ok {
+			t.Errorf("Expected no clips, got %s", child.(*gotio.Clip).Name())
+		}
+	}
+
+	var markers []string
+	for _, marker := range videoTracks[0].Markers() {
+		markedRange := marker.MarkedRange()
+		markers = append(markers, fmt.Sprintf("%s %s %v+%v %v", marker.Color(), marker.Comment(),
+			markedRange.StartTime().Value(), markedRange.Duration().Value(), marker.Metadata()["resolve_color"]))
+	}
+	expected := []string{"BLUE Start 0+1 ResolveColorBlue", "PINK Check focus 120+24 ResolveColorRose"}
+	if !slices.Equal(markers, expected) {
+		t.Errorf("Expected markers %v, got %v", expected, markers)
+	}
+}
+
 func TestDecoder_StyleVariants(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -853,3 +900,1362 @@ func TestSanitizeReelName(t *testing.T) {
 		})
 	}
 }
+
+func TestDecoder_IgnoreTimecodeMismatch(t *testing.T) {
+	// Event 002 starts one frame late and event 003 has a record duration
+	// that doesn't match its source duration.
+	edl := `TITLE: Mismatch Test
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Shot1
+
+002  AX       V     C
+     00:00:10:00 00:00:15:00 00:00:05:01 00:00:10:01
+* FROM CLIP NAME: Shot2
+
+003  AX       V     C
+     00:00:20:00 00:00:22:00 00:00:10:00 00:00:13:00
+* FROM CLIP NAME: Shot3
+`
+
+	t.Run("disabled", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		// The one frame drift is kept as a gap
+		children := timeline.VideoTracks()[0].Children()
+		if len(children) != 4 {
+			t.Fatalf("Expected 4 children, got %d", len(children))
+		}
+		if _, ok := children[1].(*gotio.Gap); !ok {
+			t.Errorf("Expected gap at index 1, got %T", children[1])
+		}
+
+		if len(decoder.Adjustments()) != 0 {
+			t.Errorf("Expected no adjustments, got %d", len(decoder.Adjustments()))
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+		decoder.SetIgnoreTimecodeMismatch(true)
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		children := timeline.VideoTracks()[0].Children()
+		if len(children) != 3 {
+			t.Fatalf("Expected 3 clips, got %d children", len(children))
+		}
+		for i, child := range children {
+			if _, ok := child.(*gotio.Clip); !ok {
+				t.Errorf("Expected clip at index %d, got %T", i, child)
+			}
+		}
+
+		adjustments := decoder.Adjustments()
+		if len(adjustments) != 2 {
+			t.Fatalf("Expected 2 adjustments, got %d", len(adjustments))
+		}
+
+		want := []TimecodeAdjustment{
+			{
+				EventNumber:       2,
+				TrackType:         TrackTypeVideo,
+				OriginalRecordIn:  "00:00:05:01",
+				OriginalRecordOut: "00:00:10:01",
+				RecordIn:          "00:00:05:00",
+				RecordOut:         "00:00:10:00",
+				RecordInDelta:     -1,
+				RecordOutDelta:    -1,
+			},
+			{
+				EventNumber:       3,
+				TrackType:         TrackTypeVideo,
+				OriginalRecordIn:  "00:00:10:00",
+				OriginalRecordOut: "00:00:13:00",
+				RecordIn:          "00:00:10:00",
+				RecordOut:         "00:00:12:00",
+				RecordInDelta:     0,
+				RecordOutDelta:    -24,
+			},
+		}
+		for i := range want {
+			if adjustments[i] != want[i] {
+				t.Errorf("Adjustment %d = %+v, want %+v", i, adjustments[i], want[i])
+			}
+		}
+	})
+
+	t.Run("first event of a track", func(t *testing.T) {
+		// The audio track starts a frame after the timeline, which is not
+		// drift from a previous event
+		edl := `TITLE: Track Start Test
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+
+002  BX       A     C
+     00:00:10:00 00:00:14:23 00:00:00:01 00:00:05:00
+`
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+		decoder.SetIgnoreTimecodeMismatch(true)
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		if adjustments := decoder.Adjustments(); len(adjustments) != 0 {
+			t.Errorf("Expected no adjustments, got %+v", adjustments)
+		}
+
+		children := timeline.AudioTracks()[0].Children()
+		if len(children) != 2 {
+			t.Fatalf("Expected a gap and a clip, got %d children", len(children))
+		}
+		gap, ok := children[0].(*gotio.Gap)
+		if !ok {
+			t.Fatalf("Expected gap at index 0, got %T", children[0])
+		}
+		duration, err := gap.Duration()
+		if err != nil {
+			t.Fatalf("Duration() error = %v", err)
+		}
+		if duration.Value() != 1 {
+			t.Errorf("Expected a 1 frame gap, got %v", duration.Value())
+		}
+	})
+
+	t.Run("linked channels", func(t *testing.T) {
+		// Event 002 on video and audio 1 and 2 starts one frame late
+		edl := `TITLE: Linked Mismatch Test
+FCM: NON-DROP FRAME
+
+001  AX       AA/V  C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+002  BX       AA/V  C        00:00:10:00 00:00:15:00 00:00:05:01 00:00:10:01
+`
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+		decoder.SetIgnoreTimecodeMismatch(true)
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		// The event is adjusted once, for all of its channels
+		adjustments := decoder.Adjustments()
+		if len(adjustments) != 1 || adjustments[0].TrackType != "AA/V" || adjustments[0].RecordIn != "00:00:05:00" {
+			t.Fatalf("Expected 1 adjustment of event 002 to 00:00:05:00, got %+v", adjustments)
+		}
+
+		tracks := append(timeline.VideoTracks(), timeline.AudioTracks()...)
+		if len(tracks) != 3 {
+			t.Fatalf("Expected 3 tracks, got %d", len(tracks))
+		}
+		for _, track := range tracks {
+			children := track.Children()
+			if len(children) != 2 {
+				t.Errorf("Track %s: expected 2 clips, got %d children", track.Name(), len(children))
+				continue
+			}
+			for _, child := range children {
+				if _, ok := child.(*gotio.Clip); !ok {
+					t.Errorf("Track %s: expected clips only, got %T", track.Name(), child)
+				}
+			}
+			duration, err := track.Duration()
+			if err != nil {
+				t.Fatalf("Duration() error = %v", err)
+			}
+			if duration.Value() != 240 {
+				t.Errorf("Track %s: expected 240 frames, got %v", track.Name(), duration.Value())
+			}
+		}
+	})
+
+	t.Run("drop frame", func(t *testing.T) {
+		// Inferred timecodes are written with the counting of their event
+		edl := `TITLE: Drop Frame Mismatch Test
+FCM: DROP FRAME
+
+001  AX       V     C
+     00:00:00;00 00:01:00;02 00:00:00;00 00:01:00;02
+
+002  AX       V     C
+     00:10:00;00 00:10:05;00 00:01:00;03 00:01:05;03
+
+FCM: NON-DROP FRAME
+
+003  AX       V     C
+     00:20:00:00 00:20:02:00 00:01:05:02 00:01:07:03
+`
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(29.97)
+		decoder.SetIgnoreTimecodeMismatch(true)
+
+		if _, err := decoder.Decode(); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		want := []TimecodeAdjustment{
+			{
+				EventNumber:       2,
+				TrackType:         TrackTypeVideo,
+				OriginalRecordIn:  "00:01:00;03",
+				OriginalRecordOut: "00:01:05;03",
+				RecordIn:          "00:01:00;02",
+				RecordOut:         "00:01:05;02",
+				RecordInDelta:     -1,
+				RecordOutDelta:    -1,
+			},
+			{
+				EventNumber:       3,
+				TrackType:         TrackTypeVideo,
+				OriginalRecordIn:  "00:01:05:02",
+				OriginalRecordOut: "00:01:07:03",
+				RecordIn:          "00:01:05:02",
+				RecordOut:         "00:01:07:02",
+				RecordInDelta:     0,
+				RecordOutDelta:    -1,
+			},
+		}
+		adjustments := decoder.Adjustments()
+		if len(adjustments) != len(want) {
+			t.Fatalf("Expected %d adjustments, got %+v", len(want), adjustments)
+		}
+		for i := range want {
+			if adjustments[i] != want[i] {
+				t.Errorf("Adjustment %d = %+v, want %+v", i, adjustments[i], want[i])
+			}
+		}
+	})
+}
+
+func TestDecoder_DropFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		edl      string
+		expected []float64 // expected clip durations in frames
+	}{
+		{
+			name: "FCM header",
+			edl: `TITLE: Drop Frame Test
+FCM: DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:10:00:00 00:00:00:00 00:10:00:00
+`,
+			expected: []float64{17982},
+		},
+		{
+			name: "Non-drop header",
+			edl: `TITLE: Non-Drop Frame Test
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:10:00:00 00:00:00:00 00:10:00:00
+`,
+			expected: []float64{18000},
+		},
+		{
+			name: "Semicolon separator",
+			edl: `TITLE: Semicolon Test
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00;00 00:10:00;00 00:00:00;00 00:10:00;00
+`,
+			expected: []float64{17982},
+		},
+		{
+			name: "Mid-list FCM",
+			edl: `TITLE: Mixed Test
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:01:00:00 00:00:00:00 00:01:00:00
+
+FCM: DROP FRAME
+
+002  AX       V     C
+     00:01:00;02 00:02:00;02 00:01:00;02 00:02:00;02
+`,
+			expected: []float64{1800, 1798},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(tt.edl))
+			decoder.SetRate(29.97)
+
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			children := timeline.VideoTracks()[0].Children()
+			var durations []float64
+			for _, child := range children {
+				if clip, ok := child.(*gotio.Clip); ok {
+					duration, err := clip.Duration()
+					if err != nil {
+						t.Fatalf("Duration() error = %v", err)
+					}
+					durations = append(durations, duration.Value())
+				}
+			}
+
+			if len(durations) != len(tt.expected) {
+				t.Fatalf("Expected %d clips, got %d", len(tt.expected), len(durations))
+			}
+			for i := range durations {
+				if durations[i] != tt.expected[i] {
+					t.Errorf("Clip %d: expected duration %v, got %v", i, tt.expected[i], durations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFromTimecode_DropFrame(t *testing.T) {
+	tests := []struct {
+		tc     string
+		rate   float64
+		frames float64
+	}{
+		{"00:00:59;29", 29.97, 1799},
+		{"00:01:00;02", 29.97, 1800},
+		{"00:10:00;00", 29.97, 17982},
+		{"01:00:00;00", 29.97, 107892},
+		{"00:01:00;04", 59.94, 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tc, func(t *testing.T) {
+			got, err := fromTimecode(tt.tc, tt.rate, true)
+			if err != nil {
+				t.Fatalf("fromTimecode() error = %v", err)
+			}
+			if got.Value() != tt.frames {
+				t.Errorf("fromTimecode(%q) = %v frames, want %v", tt.tc, got.Value(), tt.frames)
+			}
+		})
+	}
+}
+
+func TestFromTimecode_DroppedFrameNumbers(t *testing.T) {
+	// The frame numbers dropped at the start of each minute but every
+	// tenth do not exist
+	tests := []struct {
+		tc   string
+		rate float64
+	}{
+		{"00:01:00;00", 29.97},
+		{"00:01:00;01", 29.97},
+		{"01:59:00;00", 29.97},
+		{"00:01:00;03", 59.94},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tc, func(t *testing.T) {
+			if _, err := fromTimecode(tt.tc, tt.rate, true); err == nil {
+				t.Errorf("fromTimecode(%q) expected error", tt.tc)
+			}
+		})
+	}
+
+	edl := `TITLE: Dropped Frame
+FCM: DROP FRAME
+
+001  AX       V     C
+     00:00:00;00 00:01:00;00 00:00:00;00 00:01:00;00
+`
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(29.97)
+	if _, err := decoder.Decode(); err == nil {
+		t.Error("Expected error for a dropped frame number")
+	} else if parseErr, ok := err.(*ParseError); !ok || parseErr.Line != 4 {
+		t.Errorf("Expected ParseError on line 4, got %v", err)
+	}
+}
+
+func TestDecoder_DissolvePair(t *testing.T) {
+	edl := `TITLE: dissolve test
+FCM: NON-DROP FRAME
+001  TST V     C
+     01:00:04:05 01:00:04:14 01:00:00:00 01:00:00:09
+* FROM CLIP NAME:  clip_A
+002  TST V     C
+     01:00:04:14 01:00:04:14 01:00:00:09 01:00:00:09
+002  TST V     D    010
+     01:00:08:08 01:00:08:18 01:00:00:09 01:00:00:19
+* BLEND, DISSOLVE
+* FROM CLIP NAME:  clip_A
+* TO CLIP NAME:  clip_B
+003  TST V     C
+     01:00:08:18 01:00:08:19 01:00:00:19 01:00:00:20
+* FROM CLIP NAME:  clip_B
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	track := timeline.VideoTracks()[0]
+	children := track.Children()
+
+	// clip_A, Transition, clip_B (002), clip_B (003)
+	if len(children) != 4 {
+		t.Fatalf("Expected 4 children, got %d", len(children))
+	}
+
+	clipA, ok := children[0].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected clip at index 0, got %T", children[0])
+	}
+	if clipA.Name() != "clip_A" {
+		t.Errorf("Expected outgoing clip name 'clip_A', got '%s'", clipA.Name())
+	}
+	// 9 frames of cut plus half of the 10 frame dissolve
+	if clipA.SourceRange().Duration().Value() != 14 {
+		t.Errorf("Expected outgoing duration 14, got %v", clipA.SourceRange().Duration().Value())
+	}
+
+	transition, ok := children[1].(*gotio.Transition)
+	if !ok {
+		t.Fatalf("Expected transition at index 1, got %T", children[1])
+	}
+	if transition.InOffset().Value() != 5 || transition.OutOffset().Value() != 5 {
+		t.Errorf("Expected offsets 5/5, got %v/%v", transition.InOffset().Value(), transition.OutOffset().Value())
+	}
+
+	clipB, ok := children[2].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected clip at index 2, got %T", children[2])
+	}
+	if clipB.Name() != "clip_B" {
+		t.Errorf("Expected incoming clip name 'clip_B', got '%s'", clipB.Name())
+	}
+	expectedStart, _ := opentime.FromTimecode("01:00:08:13", 24)
+	if clipB.SourceRange().StartTime().Value() != expectedStart.Value() {
+		t.Errorf("Expected incoming source start %v, got %v", expectedStart.Value(), clipB.SourceRange().StartTime().Value())
+	}
+	if clipB.SourceRange().Duration().Value() != 5 {
+		t.Errorf("Expected incoming duration 5, got %v", clipB.SourceRange().Duration().Value())
+	}
+
+	// Track duration matches the record timecodes
+	duration, err := track.Duration()
+	if err != nil {
+		t.Fatalf("Duration() error = %v", err)
+	}
+	if duration.Value() != 20 {
+		t.Errorf("Expected track duration 20, got %v", duration.Value())
+	}
+}
+
+func TestDecoder_FadeFromBlack(t *testing.T) {
+	edl := `TITLE: fade test
+FCM: NON-DROP FRAME
+001  BL       V     C
+     00:00:00:00 00:00:00:00 00:00:00:00 00:00:00:00
+001  AX       V     D    030
+     01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00
+* TO CLIP NAME: Shot1
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	track := timeline.VideoTracks()[0]
+	children := track.Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 children, got %d", len(children))
+	}
+
+	black, ok := children[0].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected clip at index 0, got %T", children[0])
+	}
+	if _, ok := black.MediaReference().(*gotio.GeneratorReference); !ok {
+		t.Errorf("Expected black generator reference, got %T", black.MediaReference())
+	}
+	if black.SourceRange().Duration().Value() != 15 {
+		t.Errorf("Expected black duration 15, got %v", black.SourceRange().Duration().Value())
+	}
+
+	if _, ok := children[1].(*gotio.Transition); !ok {
+		t.Errorf("Expected transition at index 1, got %T", children[1])
+	}
+
+	duration, err := track.Duration()
+	if err != nil {
+		t.Fatalf("Duration() error = %v", err)
+	}
+	if duration.Value() != 120 {
+		t.Errorf("Expected track duration 120, got %v", duration.Value())
+	}
+}
+
+func TestDecoder_KeyEvents(t *testing.T) {
+	edl := `TITLE: Key Test
+FCM: NON-DROP FRAME
+
+001  BG       V     C
+     01:00:00:00 01:00:02:00 00:00:00:00 00:00:02:00
+* FROM CLIP NAME: Background
+
+002  BG       V     K B
+     01:00:02:00 01:00:04:00 00:00:02:00 00:00:04:00
+002  TITLE    V     K    010
+     00:00:00:00 00:00:02:00 00:00:02:00 00:00:04:00
+* FROM CLIP NAME: Background
+* TO CLIP NAME: Title
+
+003  BG       V     C
+     01:00:04:00 01:00:06:00 00:00:04:00 00:00:06:00
+* FROM CLIP NAME: Background
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(videoTracks))
+	}
+
+	// Background track keeps its full length
+	background := videoTracks[0]
+	duration, err := background.Duration()
+	if err != nil {
+		t.Fatalf("Duration() error = %v", err)
+	}
+	if duration.Value() != 144 {
+		t.Errorf("Expected background duration 144, got %v", duration.Value())
+	}
+	for i, child := range background.Children() {
+		clip, ok := child.(*gotio.Clip)
+		if !ok {
+			t.Fatalf("Expected clip at index %d, got %T", i, child)
+		}
+		if clip.Name() != "Background" {
+			t.Errorf("Expected background clip name 'Background', got '%s'", clip.Name())
+		}
+	}
+
+	// Key track holds the title at its record position
+	keyTrack := videoTracks[1]
+	if keyTrack.Name() != "V2" {
+		t.Errorf("Expected key track name 'V2', got '%s'", keyTrack.Name())
+	}
+	children := keyTrack.Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected gap and clip in key track, got %d children", len(children))
+	}
+	gap, ok := children[0].(*gotio.Gap)
+	if !ok {
+		t.Fatalf("Expected gap at index 0, got %T", children[0])
+	}
+	if gapDuration, _ := gap.Duration(); gapDuration.Value() != 48 {
+		t.Errorf("Expected gap duration 48, got %v", gapDuration.Value())
+	}
+
+	title, ok := children[1].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected clip at index 1, got %T", children[1])
+	}
+	if title.Name() != "Title" {
+		t.Errorf("Expected key clip name 'Title', got '%s'", title.Name())
+	}
+	key, ok := title.Metadata()["key"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected key metadata on foreground clip")
+	}
+	if key["type"] != "K" {
+		t.Errorf("Expected key type 'K', got %v", key["type"])
+	}
+	if key["fade_duration"] != 10 {
+		t.Errorf("Expected key fade duration 10, got %v", key["fade_duration"])
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    []TrackType
+		wantErr bool
+	}{
+		{"V", []TrackType{"V"}, false},
+		{"A", []TrackType{"A1"}, false},
+		{"A2", []TrackType{"A2"}, false},
+		{"A12", []TrackType{"A12"}, false},
+		{"AA", []TrackType{"A1", "A2"}, false},
+		{"B", []TrackType{"V", "A1"}, false},
+		{"A/V", []TrackType{"V", "A1"}, false},
+		{"A2/V", []TrackType{"V", "A2"}, false},
+		{"AA/V", []TrackType{"V", "A1", "A2"}, false},
+		{"B/V", []TrackType{"V", "A1"}, false},
+		{"NONE", nil, false},
+		{"V/V", nil, true},
+		{"A0", nil, true},
+		{"X", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			channels, err := ParseChannels(tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseChannels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := channels.TrackTypes()
+			if len(got) != len(tt.want) {
+				t.Fatalf("TrackTypes() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("TrackTypes() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackType_Kind(t *testing.T) {
+	tests := []struct {
+		trackType TrackType
+		video     bool
+		audio     bool
+	}{
+		{"V", true, false},
+		{"A", false, true},
+		{"A7", false, true},
+		{"AA", false, true},
+		{"B", false, false},
+		{"AA/V", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.trackType), func(t *testing.T) {
+			if got := tt.trackType.IsVideoTrack(); got != tt.video {
+				t.Errorf("IsVideoTrack() = %v, want %v", got, tt.video)
+			}
+			if got := tt.trackType.IsAudioTrack(); got != tt.audio {
+				t.Errorf("IsAudioTrack() = %v, want %v", got, tt.audio)
+			}
+		})
+	}
+}
+
+func TestDecoder_MultiChannelEvents(t *testing.T) {
+	edl := `TITLE: Channel Test
+FCM: NON-DROP FRAME
+
+001  AX       AA    C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Stereo
+
+002  AX       AA/V  C
+     00:00:10:00 00:00:15:00 00:00:05:00 00:00:10:00
+* FROM CLIP NAME: Sync
+
+003  AX       B     C
+     00:00:20:00 00:00:25:00 00:00:10:00 00:00:15:00
+* FROM CLIP NAME: Both
+
+004  AX       A2/V  C
+     00:00:30:00 00:00:35:00 00:00:15:00 00:00:20:00
+* FROM CLIP NAME: Second
+
+005  AX       A5    C
+     00:00:40:00 00:00:45:00 00:00:20:00 00:00:25:00
+* FROM CLIP NAME: Fifth
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	// Collect clip names per track
+	clipsByTrack := make(map[string][]*gotio.Clip)
+	for _, track := range append(timeline.VideoTracks(), timeline.AudioTracks()...) {
+		for _, child := range track.Children() {
+			if clip, ok := child.(*gotio.Clip); ok {
+				clipsByTrack[track.Name()] = append(clipsByTrack[track.Name()], clip)
+			}
+		}
+	}
+
+	if len(timeline.VideoTracks()) != 1 {
+		t.Errorf("Expected 1 video track, got %d", len(timeline.VideoTracks()))
+	}
+	if len(timeline.AudioTracks()) != 3 {
+		t.Errorf("Expected 3 audio tracks, got %d", len(timeline.AudioTracks()))
+	}
+
+	expected := map[string][]string{
+		"V":  {"Sync", "Both", "Second"},
+		"A1": {"Stereo", "Sync", "Both"},
+		"A2": {"Stereo", "Sync", "Second"},
+		"A5": {"Fifth"},
+	}
+	for trackName, names := range expected {
+		clips := clipsByTrack[trackName]
+		if len(clips) != len(names) {
+			t.Errorf("Track %s: expected %d clips, got %d", trackName, len(names), len(clips))
+			continue
+		}
+		for i, name := range names {
+			if clips[i].Name() != name {
+				t.Errorf("Track %s clip %d: expected '%s', got '%s'", trackName, i, name, clips[i].Name())
+			}
+		}
+	}
+
+	// Clips from the same event are linked across tracks
+	videoSync := clipsByTrack["V"][0]
+	audioSync := clipsByTrack["A2"][1]
+	if videoSync.Metadata()["link_id"] == nil || videoSync.Metadata()["link_id"] != audioSync.Metadata()["link_id"] {
+		t.Errorf("Expected linked clips, got link ids %v and %v", videoSync.Metadata()["link_id"], audioSync.Metadata()["link_id"])
+	}
+	linkedTracks, _ := videoSync.Metadata()["linked_tracks"].([]string)
+	if strings.Join(linkedTracks, ",") != "V,A1,A2" {
+		t.Errorf("Expected linked tracks V,A1,A2, got %v", linkedTracks)
+	}
+	if _, linked := clipsByTrack["A5"][0].Metadata()["link_id"]; linked {
+		t.Error("Single channel clip should not be linked")
+	}
+}
+
+func TestDecoder_AudioChannelLines(t *testing.T) {
+	edl := `TITLE: MultiAudio
+FCM: NON-DROP FRAME
+
+001  AX       AA    C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: AX
+AUD  3    
+
+002  AX       NONE  C
+     00:00:05:00 00:00:10:00 00:00:05:00 00:00:10:00
+AUD  3 4
+* FROM CLIP NAME: Effects
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	clipCounts := make(map[string]int)
+	for _, track := range timeline.AudioTracks() {
+		for _, child := range track.Children() {
+			if _, ok := child.(*gotio.Clip); ok {
+				clipCounts[track.Name()]++
+			}
+		}
+	}
+
+	expected := map[string]int{"A1": 1, "A2": 1, "A3": 2, "A4": 1}
+	if len(clipCounts) != len(expected) {
+		t.Errorf("Expected tracks %v, got %v", expected, clipCounts)
+	}
+	for trackName, count := range expected {
+		if clipCounts[trackName] != count {
+			t.Errorf("Track %s: expected %d clips, got %d", trackName, count, clipCounts[trackName])
+		}
+	}
+	if len(timeline.VideoTracks()) != 0 {
+		t.Errorf("Expected no video tracks, got %d", len(timeline.VideoTracks()))
+	}
+}
+
+func TestDecoder_TrackOrder(t *testing.T) {
+	edl := `TITLE: Track Order
+FCM: NON-DROP FRAME
+
+001  A5       A5    C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+002  A2       A2    C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+003  AX       AA/V  C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+004  BG       V     KB
+     00:00:05:00 00:00:10:00 00:00:05:00 00:00:10:00
+004  FG       V     K
+     00:00:05:00 00:00:10:00 00:00:05:00 00:00:10:00
+`
+
+	trackNames := func(timeline *gotio.Timeline) string {
+		var names []string
+		for _, child := range timeline.Tracks().Children() {
+			if track, ok := child.(*gotio.Track); ok {
+				names = append(names, track.Name())
+			}
+		}
+		return strings.Join(names, ",")
+	}
+
+	// Events 002 and 003 overlap on A2, so A2 has a second layer, which
+	// follows it in track order. Key foregrounds are above all other tracks.
+	t.Run("default", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			decoder := NewDecoder(strings.NewReader(edl))
+			decoder.SetRate(24.0)
+
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got := trackNames(timeline); got != "V,A1,A2,A2.2,A5,V2" {
+				t.Fatalf("Expected tracks V,A1,A2,A2.2,A5,V2, got %s", got)
+			}
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+		decoder.SetTrackOrder(func(a, b TrackType) int {
+			return -CompareTrackTypes(a, b)
+		})
+		decoder.SetTrackNamer(func(trackType TrackType, layer int) string {
+			if trackType == TrackTypeVideo {
+				return fmt.Sprintf("V%d", layer)
+			}
+			return string(trackType)
+		})
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if got := trackNames(timeline); got != "A5,A2,A2,A1,V1,V2" {
+			t.Errorf("Expected tracks A5,A2,A2,A1,V1,V2, got %s", got)
+		}
+	})
+
+	// Track types the order ranks the same keep the default order
+	t.Run("ties", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			decoder := NewDecoder(strings.NewReader(edl))
+			decoder.SetRate(24.0)
+			decoder.SetTrackOrder(func(a, b TrackType) int {
+				if a.IsAudioTrack() == b.IsAudioTrack() {
+					return 0
+				}
+				if a.IsAudioTrack() {
+					return -1
+				}
+				return 1
+			})
+
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got := trackNames(timeline); got != "A1,A2,A2.2,A5,V,V2" {
+				t.Fatalf("Expected tracks A1,A2,A2.2,A5,V,V2, got %s", got)
+			}
+		}
+	})
+}
+
+func TestCompareTrackTypes(t *testing.T) {
+	trackTypes := []TrackType{"A10", "A2", "V", "A", "A3"}
+	slices.SortFunc(trackTypes, CompareTrackTypes)
+
+	expected := []TrackType{"V", "A", "A2", "A3", "A10"}
+	if !slices.Equal(trackTypes, expected) {
+		t.Errorf("Expected %v, got %v", expected, trackTypes)
+	}
+}
+
+func TestDecoder_TitleAndHeaderComments(t *testing.T) {
+	edl := `TITLE: Reel 1 Conform
+FCM: NON-DROP FRAME
+* PROJECT: Feature
+* EDITOR: Assistant
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 01:00:00:00 01:00:05:00
+* FROM CLIP NAME: Shot 1
+* EVENT NOTE
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	if timeline.Name() != "Reel 1 Conform" {
+		t.Errorf("Expected timeline name 'Reel 1 Conform', got '%s'", timeline.Name())
+	}
+
+	comments, _ := timeline.Metadata()["header_comments"].([]string)
+	if strings.Join(comments, "\n") != "* PROJECT: Feature\n* EDITOR: Assistant" {
+		t.Errorf("Unexpected header comments %q", comments)
+	}
+}
+
+func TestDecoder_GlobalStartTime(t *testing.T) {
+	edl := `TITLE: Start Time
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 01:00:00:00 01:00:05:00
+002  AX       V     C
+     00:00:05:00 00:00:10:00 01:00:05:00 01:00:10:00
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	start := timeline.GlobalStartTime()
+	if start == nil {
+		t.Fatal("Expected a global start time")
+	}
+	if start.Value() != 86400 || start.Rate() != 24 {
+		t.Errorf("Expected global start time 86400@24, got %v", start)
+	}
+
+	// Tracks start at the global start time, without a leading gap
+	children := timeline.VideoTracks()[0].Children()
+	if _, ok := children[0].(*gotio.Clip); !ok {
+		t.Errorf("Expected the track to start with a clip, got %T", children[0])
+	}
+}
+
+func TestDecoder_LenientMode(t *testing.T) {
+	edl := `TITLE: Supplier EDL
+FCM: DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* LOC: 00:00:01;30 RED Bad frame count
+002  BX       V     C
+     00:00:00:00 00:00:05;99 00:00:05:00 00:00:10:00
+003  CX       V     C
+00:00:00:00 00:00:05:00 00:00:10:00
+004  DX       V     C
+     00:00:00:00 00:00:05:00 00:00:10:00 00:00:15:00
+`
+
+	t.Run("lenient", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(29.97)
+		decoder.SetMode(DecodeModeLenient)
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		var clips []string
+		for _, child := range timeline.VideoTracks()[0].Children() {
+			if clip, ok := child.(*gotio.Clip); ok {
+				clips = append(clips, clip.Name())
+				if len(clip.Markers()) != 0 {
+					t.Errorf("Expected the invalid marker on %s to be dropped", clip.Name())
+				}
+			}
+		}
+		if strings.Join(clips, ",") != "AX,DX" {
+			t.Errorf("Expected clips AX,DX, got %v", clips)
+		}
+
+		// Problems on the timecode line of an event are reported on the
+		// lines of the event
+		codes := make(map[string][2]int)
+		for _, diagnostic := range decoder.Diagnostics() {
+			codes[diagnostic.Code] = [2]int{diagnostic.Line, diagnostic.EndLine}
+		}
+		expected := map[string][2]int{
+			DiagnosticMissingTimecode: {9, 10},
+			DiagnosticInvalidTimecode: {7, 8},
+			DiagnosticInvalidMarker:   {4, 6},
+		}
+		if len(codes) != len(expected) {
+			t.Errorf("Expected diagnostics %v, got %v", expected, decoder.Diagnostics())
+		}
+		for code, line := range expected {
+			if codes[code] != line {
+				t.Errorf("Expected %s on lines %v, got %v", code, line, decoder.Diagnostics())
+			}
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(29.97)
+		decoder.SetMode(DecodeModeStrict)
+
+		_, err := decoder.Decode()
+		// The invalid locator on line 6 is the first problem in the EDL
+		if parseErr, ok := err.(*ParseError); !ok || parseErr.Line != 4 || parseErr.EndLine != 6 {
+			t.Errorf("Expected ParseError on lines 4-6, got %v", err)
+		}
+	})
+}
+
+func TestDecoder_SourceLines(t *testing.T) {
+	edl := `TITLE: Source Lines
+FCM: DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Shot 1
+
+002  BX       V     C
+     00:00:00:00 00:00:05;99 00:00:05:00 00:00:10:00
+* FROM CLIP NAME: Shot 2
+* LOC: 00:00:01:00 RED Check this
+`
+
+	t.Run("error", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(29.97)
+
+		_, err := decoder.Decode()
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("Expected ParseError, got %v", err)
+		}
+		if parseErr.Line != 8 || parseErr.EndLine != 11 {
+			t.Errorf("Expected lines 8-11, got %d-%d", parseErr.Line, parseErr.EndLine)
+		}
+		if !strings.HasPrefix(err.Error(), "lines 8-11: ") {
+			t.Errorf("Expected error to give lines 8-11, got %q", err.Error())
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(29.97)
+		decoder.SetMode(DecodeModeLenient)
+		decoder.SetSourceLines(true)
+
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		clip, ok := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+		if !ok {
+			t.Fatalf("Expected clip, got %T", timeline.VideoTracks()[0].Children()[0])
+		}
+		source, ok := clip.Metadata()["cmx_3600"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected cmx_3600 metadata, got %v", clip.Metadata())
+		}
+		if source["line"] != 4 || source["end_line"] != 6 {
+			t.Errorf("Expected lines 4-6, got %v-%v", source["line"], source["end_line"])
+		}
+	})
+}
+
+func TestDecoder_OverlappingEvents(t *testing.T) {
+	// Event 002 is superimposed over event 001, events 003 and 004 are out
+	// of order, and the second event 003 overlaps the first
+	edl := `TITLE: Overlaps
+FCM: NON-DROP FRAME
+
+001  AX       V     C        01:00:00:00 01:00:10:00 00:00:00:00 00:00:10:00
+* FROM CLIP NAME: Background
+002  BX       V     C        02:00:00:00 02:00:02:00 00:00:02:00 00:00:04:00
+* FROM CLIP NAME: Superimpose
+004  DX       V     C        04:00:00:00 04:00:05:00 00:00:15:00 00:00:20:00
+* FROM CLIP NAME: Shot 4
+003  CX       V     C        03:00:00:00 03:00:05:00 00:00:10:00 00:00:15:00
+* FROM CLIP NAME: Shot 3
+003  EX       V     C        05:00:00:00 05:00:02:00 00:00:12:00 00:00:14:00
+* FROM CLIP NAME: Insert
+005  AX       A     C        01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00
+006  FX       A     C        06:00:00:00 06:00:04:00 00:00:02:00 00:00:06:00
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	var names []string
+	for _, child := range timeline.Tracks().Children() {
+		if track, ok := child.(*gotio.Track); ok {
+			names = append(names, track.Name())
+		}
+	}
+	if strings.Join(names, ",") != "V,V2,A1,A1.2" {
+		t.Fatalf("Expected tracks V,V2,A1,A1.2, got %v", names)
+	}
+
+	// Each track holds its events in record order at their record positions
+	layout := func(track *gotio.Track) []string {
+		var items []string
+		for _, child := range track.Children() {
+			duration, err := child.(interface {
+				Duration() (opentime.RationalTime, error)
+			}).Duration()
+			if err != nil {
+				t.Fatalf("Duration() error = %v", err)
+			}
+			name := "gap"
+			if clip, ok := child.(*gotio.Clip); ok {
+				name = clip.Name()
+			}
+			items = append(items, fmt.Sprintf("%s:%v", name, duration.Value()))
+		}
+		return items
+	}
+
+	videoTracks := timeline.VideoTracks()
+	expected := [][]string{
+		{"Background:240", "Shot 3:120", "Shot 4:120"},
+		{"gap:48", "Superimpose:48", "gap:192", "Insert:48"},
+	}
+	for i, want := range expected {
+		if got := layout(videoTracks[i]); !slices.Equal(got, want) {
+			t.Errorf("Video track %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+
+	audioTracks := timeline.AudioTracks()
+	if got := layout(audioTracks[1]); !slices.Equal(got, []string{"gap:48", "FX:96"}) {
+		t.Errorf("Expected second audio layer gap:48,FX:96, got %v", got)
+	}
+}
+
+func TestDecoder_OverlapByOneFrame(t *testing.T) {
+	// Event 002 starts a frame before event 001 ends
+	edl := `TITLE: One Frame Overlap
+FCM: NON-DROP FRAME
+
+001  AX       V     C        01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00
+002  BX       V     C        02:00:00:00 02:00:05:00 00:00:04:23 00:00:09:23
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected the overlapping event on a second track, got %d tracks", len(videoTracks))
+	}
+	for i, want := range []float64{120, 239} {
+		duration, err := videoTracks[i].Duration()
+		if err != nil {
+			t.Fatalf("Duration() error = %v", err)
+		}
+		if duration.Value() != want {
+			t.Errorf("Expected video track %d to last %v frames, got %v", i+1, want, duration.Value())
+		}
+	}
+}
+
+func TestDecoder_MotionEffects(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    string
+		effect   string
+		scalar   float64
+		start    float64
+		duration float64
+	}{
+		{
+			name: "double speed",
+			lines: `001  AX       V     C        01:00:00:00 01:00:02:00 00:00:00:00 00:00:01:00
+M2   AX       048.0                01:00:00:00`,
+			effect:   "LinearTimeWarp",
+			scalar:   2,
+			start:    86400,
+			duration: 24,
+		},
+		{
+			name: "reverse",
+			lines: `001  AX       V     C        01:00:04:00 01:00:05:00 00:00:00:00 00:00:01:00
+M2   AX       -024.0               01:00:05:00`,
+			effect:   "LinearTimeWarp",
+			scalar:   -1,
+			start:    86520,
+			duration: 24,
+		},
+		{
+			name: "zero speed",
+			lines: `001  AX       V     C        01:00:03:00 01:00:03:01 00:00:00:00 00:00:02:00
+M2   AX       000.0                01:00:03:00`,
+			effect:   "FreezeFrame",
+			start:    86472,
+			duration: 48,
+		},
+		{
+			name:     "fit to fill",
+			lines:    `001  AX       V     C        01:00:00:00 01:00:03:00 00:00:00:00 00:00:02:00`,
+			effect:   "FitToFill",
+			scalar:   1.5,
+			start:    86400,
+			duration: 48,
+		},
+		{
+			name:     "normal speed",
+			lines:    `001  AX       V     C        01:00:00:00 01:00:02:00 00:00:00:00 00:00:02:00`,
+			start:    86400,
+			duration: 48,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edl := "TITLE: Motion Effects\nFCM: NON-DROP FRAME\n\n" + tt.lines + "\n"
+
+			decoder := NewDecoder(strings.NewReader(edl))
+			decoder.SetRate(24.0)
+
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+			sourceRange := clip.SourceRange()
+			if sourceRange.StartTime().Value() != tt.start || sourceRange.Duration().Value() != tt.duration {
+				t.Errorf("Expected source range %v+%v, got %v+%v", tt.start, tt.duration,
+					sourceRange.StartTime().Value(), sourceRange.Duration().Value())
+			}
+
+			effects := clip.Effects()
+			if tt.effect == "" {
+				if len(effects) != 0 {
+					t.Errorf("Expected no effects, got %v", effects)
+				}
+				return
+			}
+			if len(effects) != 1 {
+				t.Fatalf("Expected 1 effect, got %d", len(effects))
+			}
+			switch effect := effects[0].(type) {
+			case *gotio.FreezeFrame:
+				if tt.effect != "FreezeFrame" {
+					t.Errorf("Expected %s, got FreezeFrame", tt.effect)
+				}
+			case *gotio.LinearTimeWarp:
+				name := "LinearTimeWarp"
+				if effect.Name() != "" {
+					name = effect.Name()
+				}
+				if name != tt.effect || effect.TimeScalar() != tt.scalar {
+					t.Errorf("Expected %s at %v, got %s at %v", tt.effect, tt.scalar, name, effect.TimeScalar())
+				}
+			default:
+				t.Errorf("Unexpected effect %T", effect)
+			}
+		})
+	}
+}
+
+func TestDecoder_EmptySourceRange(t *testing.T) {
+	// Event 002 plays no source for two seconds, without an M2 line
+	edl := `TITLE: Empty Source
+FCM: NON-DROP FRAME
+
+001  AX       V     C        01:00:00:00 01:00:02:00 00:00:00:00 00:00:02:00
+002  BX       V     C        02:00:00:00 02:00:00:00 00:00:02:00 00:00:04:00
+`
+
+	for _, mode := range []DecodeMode{DecodeModeDefault, DecodeModeLenient} {
+		t.Run(string(mode), func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(edl))
+			decoder.SetRate(24.0)
+			decoder.SetMode(mode)
+
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			// The event keeps its place on the track, without a freeze frame
+			children := timeline.VideoTracks()[0].Children()
+			if len(children) != 2 {
+				t.Fatalf("Expected 2 clips, got %d children", len(children))
+			}
+			clip, ok := children[1].(*gotio.Clip)
+			if !ok {
+				t.Fatalf("Expected clip at index 1, got %T", children[1])
+			}
+			if len(clip.Effects()) != 0 {
+				t.Errorf("Expected no effects, got %v", clip.Effects())
+			}
+			if duration := clip.SourceRange().Duration().Value(); duration != 48 {
+				t.Errorf("Expected the clip to last 48 frames, got %v", duration)
+			}
+
+			diagnostics := decoder.Diagnostics()
+			if len(diagnostics) != 1 || diagnostics[0].Code != DiagnosticInvalidSourceRange ||
+				diagnostics[0].Severity != SeverityWarning || diagnostics[0].Line != 5 {
+				t.Errorf("Expected an invalid_source_range warning on line 5, got %v", diagnostics)
+			}
+		})
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+		decoder.SetMode(DecodeModeStrict)
+
+		_, err := decoder.Decode()
+		if parseErr, ok := err.(*ParseError); !ok || parseErr.Line != 5 {
+			t.Errorf("Expected ParseError on line 5, got %v", err)
+		}
+	})
+}
@@ -7,6 +7,8 @@ package cmx3600
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -24,8 +26,15 @@ const (
 	EditTypeKeyBackground EditType = "KB"
 	// EditTypeKey represents a key (overlay).
 	EditTypeKey EditType = "K"
+	// EditTypeKeyOut represents a key that fades out (K O).
+	EditTypeKeyOut EditType = "KO"
 )
 
+// IsKey returns true if the edit type is a key foreground (K or K O).
+func (t EditType) IsKey() bool {
+	return t == EditTypeKey || t == EditTypeKeyOut
+}
+
 // TrackType represents the type of track in an EDL.
 type TrackType string
 
@@ -44,39 +53,156 @@ const (
 	TrackTypeAudio4 TrackType = "A4"
 )
 
-// IsVideoTrack returns true if the track type is video.
+// AudioTrackType returns the track type for audio channel n (A1, A2, ...).
+func AudioTrackType(n int) TrackType {
+	return TrackType(fmt.Sprintf("A%d", n))
+}
+
+// Channels parses the track type as a CMX 3600 track field.
+func (t TrackType) Channels() (ChannelSet, error) {
+	return ParseChannels(string(t))
+}
+
+// IsVideoTrack returns true if the track type is video only.
 func (t TrackType) IsVideoTrack() bool {
-	return t == TrackTypeVideo
+	channels, err := t.Channels()
+	return err == nil && channels.Video && len(channels.Audio) == 0
 }
 
-// IsAudioTrack returns true if the track type is audio.
+// IsAudioTrack returns true if the track type is audio only.
 func (t TrackType) IsAudioTrack() bool {
-	return t == TrackTypeAudio ||
-		t == TrackTypeAudio1 ||
-		t == TrackTypeAudio2 ||
-		t == TrackTypeAudio3 ||
-		t == TrackTypeAudio4
+	channels, err := t.Channels()
+	return err == nil && !channels.Video && len(channels.Audio) > 0
+}
+
+// CompareTrackTypes orders track types video first, then audio channels in
+// ascending order. Track types that are not valid track fields sort by name.
+func CompareTrackTypes(a, b TrackType) int {
+	aChannels, aErr := a.Channels()
+	bChannels, bErr := b.Channels()
+	if aErr == nil && bErr == nil {
+		if aChannels.Video != bChannels.Video {
+			if aChannels.Video {
+				return -1
+			}
+			return 1
+		}
+		if c := slices.Compare(aChannels.Audio, bChannels.Audio); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(string(a), string(b))
+}
+
+// TrackNamer returns the name of a decoded track. Layer is 1 for the track
+// holding the events on a channel, and counts up through the tracks of
+// overlapping events and then of key foregrounds layered over it.
+type TrackNamer func(trackType TrackType, layer int) string
+
+// DefaultTrackNamer names tracks after their track type, with the layer
+// number appended to layered tracks (V, A1, V2, A1.2).
+func DefaultTrackNamer(trackType TrackType, layer int) string {
+	if layer > 1 && trackType.IsAudioTrack() {
+		return fmt.Sprintf("%s.%d", trackType, layer)
+	}
+	if layer > 1 {
+		return fmt.Sprintf("%s%d", trackType, layer)
+	}
+	return string(trackType)
+}
+
+// ChannelSet describes the video and audio channels an event applies to.
+type ChannelSet struct {
+	Video bool  // Event applies to the video channel
+	Audio []int // Audio channel numbers, in ascending order
+}
+
+// ParseChannels parses a CMX 3600 track field into a ChannelSet. Supported
+// fields are V, A, A2 and higher channel numbers, AA (audio 1 and 2), B
+// (both: audio 1 and video), NONE, and any audio field followed by /V for
+// audio with video.
+func ParseChannels(field string) (ChannelSet, error) {
+	var channels ChannelSet
+
+	audio := strings.ToUpper(strings.TrimSpace(field))
+	if before, found := strings.CutSuffix(audio, "/V"); found {
+		channels.Video = true
+		audio = before
+	}
+
+	switch {
+	case audio == "V" && !channels.Video:
+		channels.Video = true
+	case audio == "NONE" && !channels.Video:
+	case audio == "A":
+		channels.Audio = []int{1}
+	case audio == "AA":
+		channels.Audio = []int{1, 2}
+	case audio == "B":
+		channels.Video = true
+		channels.Audio = []int{1}
+	case strings.HasPrefix(audio, "A"):
+		n, err := strconv.Atoi(audio[1:])
+		if err != nil || n < 1 {
+			return ChannelSet{}, fmt.Errorf("invalid track field %q", field)
+		}
+		channels.Audio = []int{n}
+	default:
+		return ChannelSet{}, fmt.Errorf("invalid track field %q", field)
+	}
+
+	return channels, nil
+}
+
+// WithAudio returns a copy of the channel set that also includes audio
+// channel n.
+func (c ChannelSet) WithAudio(n int) ChannelSet {
+	if slices.Contains(c.Audio, n) {
+		return c
+	}
+	audio := append(slices.Clone(c.Audio), n)
+	slices.Sort(audio)
+	return ChannelSet{Video: c.Video, Audio: audio}
+}
+
+// TrackTypes returns the track type of each channel in the set, video first.
+func (c ChannelSet) TrackTypes() []TrackType {
+	var types []TrackType
+	if c.Video {
+		types = append(types, TrackTypeVideo)
+	}
+	for _, n := range c.Audio {
+		types = append(types, AudioTrackType(n))
+	}
+	return types
 }
 
 // EDLEvent represents a single edit event in an EDL.
 type EDLEvent struct {
-	EventNumber        int       // Event number (line number in EDL)
-	ReelName           string    // Source reel/tape name
-	TrackType          TrackType // Track type (V, A, A1, A2, etc.)
-	EditType           EditType  // Edit type (C, D, W, etc.)
-	SourceIn           string    // Source in timecode (HH:MM:SS:FF)
-	SourceOut          string    // Source out timecode (HH:MM:SS:FF)
-	RecordIn           string    // Record in timecode (HH:MM:SS:FF)
-	RecordOut          string    // Record out timecode (HH:MM:SS:FF)
-	Comment            string    // Optional comment line(s)
-	ClipName           string    // Clip name from comment
-	TransitionDuration int       // Transition duration in frames (for dissolves/wipes)
-	WipeCode           string    // Wipe code (e.g., W001, W002)
+	EventNumber        int          // Event number (line number in EDL)
+	Line               int          // Line of the event in the EDL file
+	EndLine            int          // Last line of the event in the EDL file
+	ReelName           string       // Source reel/tape name
+	TrackType          TrackType    // Track field as written (V, A, A2, AA/V, etc.)
+	Channels           ChannelSet   // Channels parsed from the track field
+	EditType           EditType     // Edit type (C, D, W, etc.)
+	SourceIn           string       // Source in timecode (HH:MM:SS:FF)
+	SourceOut          string       // Source out timecode (HH:MM:SS:FF)
+	RecordIn           string       // Record in timecode (HH:MM:SS:FF)
+	RecordOut          string       // Record out timecode (HH:MM:SS:FF)
+	Comment            string       // Optional comment line(s)
+	CommentLines       []string     // Comment lines as written, including recognised ones
+	UnknownLines       []string     // Unrecognised lines as written
+	ClipName           string       // Clip name from comment
+	TransitionDuration int          // Transition duration in frames (for dissolves/wipes)
+	WipeCode           string       // Wipe code (e.g., W001, W002)
 	SpeedEffect        *SpeedEffect // M2 motion effect
-	FreezeFrame        bool      // Freeze frame detected
-	FilePath           string    // File path from FROM CLIP/FROM FILE comment
-	Markers            []Marker  // Locators/markers
-	ASCCDL             *ASCCDL   // ASC CDL color correction
+	FreezeFrame        bool         // Freeze frame detected
+	FilePath           string       // File path from FROM CLIP/FROM FILE comment
+	Markers            []Marker     // Locators/markers
+	ASCCDL             *ASCCDL      // ASC CDL color correction
+	DropFrame          bool         // Timecodes use drop frame counting
+	Outgoing           *EDLEvent    // Outgoing cut line of a dissolve/wipe pair, or KB line of a key
 }
 
 // SpeedEffect represents an M2 motion effect.
@@ -91,6 +217,38 @@ type Marker struct {
 	Timecode string // Marker timecode
 	Color    string // Marker color
 	Comment  string // Marker comment
+	Duration int    // Marker length in frames, 0 for a single frame locator
+
+	// ResolveColor is the DaVinci Resolve colour as written, such as
+	// ResolveColorRose, for a marker read with one
+	ResolveColor string
+}
+
+// resolveColorPrefix starts the marker colour names of DaVinci Resolve.
+const resolveColorPrefix = "ResolveColor"
+
+// resolveMarkerColors maps DaVinci Resolve marker colours to the
+// OpenTimelineIO marker colours they are read as.
+var resolveMarkerColors = map[string]string{
+	"Blue": "BLUE", "Cyan": "CYAN", "Green": "GREEN", "Yellow": "YELLOW",
+	"Red": "RED", "Pink": "PINK", "Purple": "PURPLE", "Fuchsia": "MAGENTA",
+	"Rose": "PINK", "Lavender": "PURPLE", "Sky": "CYAN", "Mint": "GREEN",
+	"Lemon": "YELLOW", "Sand": "ORANGE", "Cocoa": "ORANGE", "Cream": "WHITE",
+}
+
+// markerColorName returns the marker colour read for a locator colour,
+// turning a DaVinci Resolve colour such as ResolveColorBlue into BLUE. Several
+// Resolve colours read as the same marker colour, so a Resolve colour is also
+// returned as written.
+func markerColorName(color string) (string, string) {
+	name, ok := strings.CutPrefix(color, resolveColorPrefix)
+	if !ok {
+		return color, ""
+	}
+	if mapped, ok := resolveMarkerColors[name]; ok {
+		return mapped, color
+	}
+	return strings.ToUpper(name), color
 }
 
 // ASCCDL represents ASC Color Decision List metadata.
@@ -101,6 +259,19 @@ type ASCCDL struct {
 	Saturation float64    // Saturation value
 }
 
+// TimecodeAdjustment describes a record timecode correction made by the
+// decoder when timecode mismatches are ignored.
+type TimecodeAdjustment struct {
+	EventNumber       int       // Event number of the adjusted event
+	TrackType         TrackType // Track the event belongs to
+	OriginalRecordIn  string    // Record in timecode as written in the EDL
+	OriginalRecordOut string    // Record out timecode as written in the EDL
+	RecordIn          string    // Inferred record in timecode
+	RecordOut         string    // Inferred record out timecode
+	RecordInDelta     int       // Frames the record in was moved by
+	RecordOutDelta    int       // Frames the record out was moved by
+}
+
 // OutputStyle represents the style/flavor of EDL output.
 type OutputStyle string
 
@@ -111,8 +282,45 @@ const (
 	OutputStyleNucoda OutputStyle = "nucoda"
 	// OutputStylePremiere represents Adobe Premiere Pro style EDL.
 	OutputStylePremiere OutputStyle = "premiere"
+	// OutputStyleCMX3600 represents a spec-strict CMX 3600 EDL, with audio
+	// channels 3 and 4 written as AUD lines rather than A3/A4 track fields.
+	OutputStyleCMX3600 OutputStyle = "cmx3600"
+	// OutputStyleResolve represents DaVinci Resolve style EDL, with SOURCE
+	// FILE paths and Resolve marker lines.
+	OutputStyleResolve OutputStyle = "resolve"
 )
 
+// styleRules holds what sets the output styles apart.
+type styleRules struct {
+	reelNameLen     int    // Longest reel name
+	upperReels      bool   // Reel names are written in upper case
+	auxReels        bool   // Media is written as the auxiliary source reel, identified by clip name
+	pathKeyword     string // Comment keyword of the media path
+	writePaths      bool   // The encoder writes media paths
+	inlineTimecodes bool   // Timecodes are written in columns on the event line
+	resolveMarkers  bool   // Markers at the event start are written as Resolve marker lines
+}
+
+// outputStyles holds the rules of each output style. Avid writes paths as
+// FROM CLIP comments, Nucoda as FROM FILE comments, with longer reel names,
+// and Resolve as SOURCE FILE comments. Premiere writes every clip on the AX
+// reel, and strict CMX 3600 output has upper case reel names.
+var outputStyles = map[OutputStyle]styleRules{
+	OutputStyleAvid:     {reelNameLen: DefaultReelNameLength, pathKeyword: "FROM CLIP", writePaths: true, inlineTimecodes: true},
+	OutputStyleNucoda:   {reelNameLen: 32, pathKeyword: "FROM FILE", writePaths: true, inlineTimecodes: true},
+	OutputStylePremiere: {reelNameLen: DefaultReelNameLength, auxReels: true, pathKeyword: "FROM CLIP", inlineTimecodes: true},
+	OutputStyleCMX3600:  {reelNameLen: DefaultReelNameLength, upperReels: true, pathKeyword: "FROM CLIP", inlineTimecodes: true},
+	OutputStyleResolve:  {reelNameLen: DefaultReelNameLength, pathKeyword: "SOURCE FILE", writePaths: true, inlineTimecodes: true, resolveMarkers: true},
+}
+
+// rules returns the rules of an output style. Unknown styles follow Avid.
+func (s OutputStyle) rules() styleRules {
+	if rules, ok := outputStyles[s]; ok {
+		return rules
+	}
+	return outputStyles[OutputStyleAvid]
+}
+
 // DefaultReelNameLength is the default maximum length for reel names.
 const DefaultReelNameLength = 8
 
@@ -141,21 +349,176 @@ func SanitizeReelName(name string, maxLength int) string {
 	return name
 }
 
+// GeneratorReel maps reel names to a source that has no media of its own:
+// a generator such as black or bars, or an auxiliary source.
+type GeneratorReel struct {
+	Reel    string   // Reel name written by the encoder
+	Aliases []string // Other reel names read as the same source
+	Kind    string   // GeneratorKind of the GeneratorReference, empty for an auxiliary source
+}
+
+// GeneratorTable is the list of generator reels used to decode and encode
+// generated sources. Reel names are matched without regard to case.
+type GeneratorTable []GeneratorReel
+
+// DefaultGeneratorTable returns the generator table used unless another is
+// set: black as BL, BLK or BLACK, bars as BARS, slug as SLUG and auxiliary
+// sources as AX.
+func DefaultGeneratorTable() GeneratorTable {
+	return GeneratorTable{
+		{Reel: "BL", Aliases: []string{"BLK", "BLACK"}, Kind: "black"},
+		{Reel: "BARS", Kind: "SMPTEBars"},
+		{Reel: "SLUG", Kind: "slug"},
+		{Reel: "AX"},
+	}
+}
+
+// Lookup returns the generator reel that reel names.
+func (t GeneratorTable) Lookup(reel string) (GeneratorReel, bool) {
+	for _, generator := range t {
+		if strings.EqualFold(generator.Reel, reel) || slices.ContainsFunc(generator.Aliases, func(alias string) bool {
+			return strings.EqualFold(alias, reel)
+		}) {
+			return generator, true
+		}
+	}
+	return GeneratorReel{}, false
+}
+
+// ReelForKind returns the reel written for a generator kind. Generators
+// missing from the table are written as the auxiliary source reel.
+func (t GeneratorTable) ReelForKind(kind string) string {
+	for _, generator := range t {
+		if generator.Kind != "" && strings.EqualFold(generator.Kind, kind) {
+			return generator.Reel
+		}
+	}
+	return t.AuxReel()
+}
+
+// AuxReel returns the reel written for an auxiliary source, the first
+// generator reel without a kind, or AX.
+func (t GeneratorTable) AuxReel() string {
+	for _, generator := range t {
+		if generator.Kind == "" {
+			return generator.Reel
+		}
+	}
+	return "AX"
+}
+
+// BlackReel returns the reel written for black, or BL.
+func (t GeneratorTable) BlackReel() string {
+	for _, generator := range t {
+		if strings.EqualFold(generator.Kind, "black") {
+			return generator.Reel
+		}
+	}
+	return "BL"
+}
+
+// DecodeMode controls how problems in an EDL are handled while decoding.
+type DecodeMode string
+
+const (
+	// DecodeModeDefault fails on events that cannot be read, and reports
+	// other problems as diagnostics.
+	DecodeModeDefault DecodeMode = "default"
+	// DecodeModeLenient skips events that cannot be read, and reports every
+	// problem as a diagnostic.
+	DecodeModeLenient DecodeMode = "lenient"
+	// DecodeModeStrict fails on the first problem.
+	DecodeModeStrict DecodeMode = "strict"
+)
+
+// Severity represents the severity of a diagnostic.
+type Severity string
+
+const (
+	// SeverityWarning marks a problem that was ignored or worked around.
+	SeverityWarning Severity = "warning"
+	// SeverityError marks an event that could not be read.
+	SeverityError Severity = "error"
+)
+
+// Diagnostic codes identify the kind of problem found in an EDL.
+const (
+	DiagnosticMissingTimecode    = "missing_timecode"     // Event line without a timecode line
+	DiagnosticInvalidTrack       = "invalid_track"        // Track field that cannot be parsed
+	DiagnosticInvalidEdit        = "invalid_edit"         // Edit type field that cannot be parsed
+	DiagnosticInvalidTimecode    = "invalid_timecode"     // Event timecode that cannot be parsed
+	DiagnosticInvalidSourceRange = "invalid_source_range" // Empty source range played for a record range
+	DiagnosticInvalidMarker      = "invalid_marker"       // Locator timecode that cannot be parsed
+	DiagnosticInvalidSpeedEffect = "invalid_speed_effect" // M2 line that cannot be parsed
+	DiagnosticUnknownLine        = "unknown_line"         // Line that is not part of the EDL format
+)
+
+// Diagnostic describes a problem found while decoding an EDL. EndLine is set
+// when the problem concerns an event spanning several lines.
+type Diagnostic struct {
+	Line     int      // Line number, starting at 1
+	EndLine  int      // Last line, for a problem spanning several lines
+	Column   int      // Column number, starting at 1, or 0 for the whole line
+	Severity Severity // Severity of the problem
+	Code     string   // Kind of problem, one of the Diagnostic codes
+	Message  string   // Description of the problem
+}
+
+func (d Diagnostic) String() string {
+	if d.EndLine > d.Line {
+		return fmt.Sprintf("lines %d-%d: %s: %s (%s)", d.Line, d.EndLine, d.Severity, d.Message, d.Code)
+	}
+	if d.Column > 0 {
+		return fmt.Sprintf("line %d:%d: %s: %s (%s)", d.Line, d.Column, d.Severity, d.Message, d.Code)
+	}
+	return fmt.Sprintf("line %d: %s: %s (%s)", d.Line, d.Severity, d.Message, d.Code)
+}
+
+// check returns a *ParseError if the problem is fatal in mode.
+func (d Diagnostic) check(mode DecodeMode) error {
+	if mode == DecodeModeStrict || (mode != DecodeModeLenient && d.Severity == SeverityError) {
+		return &ParseError{Line: d.Line, EndLine: d.EndLine, Message: d.Message}
+	}
+	return nil
+}
+
 // ParseError represents an error that occurred during EDL parsing.
+// EndLine is set when the error concerns an event spanning several lines,
+// and Err to the underlying error, if any.
 type ParseError struct {
 	Line    int
+	EndLine int
 	Message string
+	Err     error
 }
 
 func (e *ParseError) Error() string {
+	if e.EndLine > e.Line {
+		return fmt.Sprintf("lines %d-%d: %s", e.Line, e.EndLine, e.Message)
+	}
 	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
 }
 
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // EncodeError represents an error that occurred during EDL encoding.
+// EventNumber and Field are set when a field of an event, or of the header,
+// cannot be represented in the EDL.
 type EncodeError struct {
-	Message string
+	EventNumber int
+	Field       string
+	Message     string
 }
 
 func (e *EncodeError) Error() string {
-	return fmt.Sprintf("encode error: %s", e.Message)
+	message := e.Message
+	if e.Field != "" {
+		message = fmt.Sprintf("%s: %s", e.Field, message)
+	}
+	if e.EventNumber > 0 {
+		message = fmt.Sprintf("event %03d: %s", e.EventNumber, message)
+	}
+	return fmt.Sprintf("encode error: %s", message)
 }
@@ -6,6 +6,9 @@ package cmx3600
 import (
 	"fmt"
 	"io"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/Avalanche-io/gotio/opentime"
@@ -14,31 +17,50 @@ import (
 
 // Encoder writes OpenTimelineIO Timeline to CMX 3600 EDL format.
 type Encoder struct {
-	w             io.Writer
-	style         OutputStyle
-	reelNameLen   int
-	rate          float64
+	w              io.Writer
+	style          OutputStyle
+	reelNameLen    int
+	reelNameLenSet bool // Whether the reel name length was set, not taken from the style
+	rate           float64
+	recordStart    *opentime.RationalTime
+	preserveEvents bool
+	cdlPrecision   int
+	generators     GeneratorTable
+	gapsAsBlack    bool
+	events         *EventWriter
+	linked         map[string]*linkedEvent
+	warnings       []*EncodeError
 }
 
 // NewEncoder creates a new EDL encoder.
 func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{
-		w:           w,
-		style:       OutputStyleAvid,
-		reelNameLen: DefaultReelNameLength,
-		rate:        24.0, // Default frame rate
+		w:            w,
+		style:        OutputStyleAvid,
+		reelNameLen:  DefaultReelNameLength,
+		rate:         24.0, // Default frame rate
+		cdlPrecision: -1,
+		generators:   DefaultGeneratorTable(),
 	}
 }
 
-// SetStyle sets the output style (avid, nucoda, premiere).
+// SetStyle sets the output style (avid, nucoda, premiere, cmx3600,
+// resolve), and the reel name length to the style's limit unless it has been
+// set with SetReelNameLength. The style sets the comment keywords, whether
+// media paths are written, how reels are named and the column layout.
 func (e *Encoder) SetStyle(style OutputStyle) {
 	e.style = style
+	if !e.reelNameLenSet {
+		e.reelNameLen = style.rules().reelNameLen
+	}
 }
 
-// SetReelNameLength sets the maximum length for reel names.
+// SetReelNameLength sets the maximum length for reel names, in place of the
+// limit of the style whether the style is set before or after.
 // Use 0 or negative for unlimited length.
 func (e *Encoder) SetReelNameLength(length int) {
 	e.reelNameLen = length
+	e.reelNameLenSet = true
 }
 
 // SetRate sets the frame rate for timecode generation.
@@ -46,33 +68,121 @@ func (e *Encoder) SetRate(rate float64) {
 	e.rate = rate
 }
 
+// SetRecordStart sets the record timecode the timeline starts at, overriding
+// the global start time of the encoded timeline.
+func (e *Encoder) SetRecordStart(start opentime.RationalTime) {
+	e.recordStart = &start
+}
+
+// SetPreserveEvents sets whether clips decoded from an EDL are written with
+// their original event numbers, comment lines and unrecognised lines, kept in
+// the cmx_3600 clip metadata, instead of being renumbered with generated
+// comments. Clips linked by the decoder from one multi-channel event are
+// written back as that one event.
+func (e *Encoder) SetPreserveEvents(preserve bool) {
+	e.preserveEvents = preserve
+}
+
+// SetCDLPrecision sets the number of decimal places written for ASC CDL
+// values. Use a negative value for the fewest digits that read back as the
+// same value.
+func (e *Encoder) SetCDLPrecision(digits int) {
+	e.cdlPrecision = digits
+}
+
+// SetGeneratorTable sets the reels written for generator clips. The default
+// is DefaultGeneratorTable.
+func (e *Encoder) SetGeneratorTable(table GeneratorTable) {
+	if table == nil {
+		table = DefaultGeneratorTable()
+	}
+	e.generators = table
+}
+
+// SetGapsAsBlack sets whether gaps are written as black events. Otherwise
+// only gaps holding markers are written, and other gaps are left as breaks
+// in the record timecodes.
+func (e *Encoder) SetGapsAsBlack(black bool) {
+	e.gapsAsBlack = black
+}
+
+// Warnings returns the parts of the timeline left out of the EDL by the last
+// call to Encode, such as clip effects that cannot be written.
+func (e *Encoder) Warnings() []*EncodeError {
+	return e.warnings
+}
+
 // Encode writes the Timeline to EDL format.
 func (e *Encoder) Encode(t *gotio.Timeline) error {
+	e.warnings = nil
 	if t == nil {
 		return &EncodeError{Message: "timeline is nil"}
 	}
 
+	e.events = NewEventWriter(e.w)
+	e.events.SetStyle(e.style)
+	e.events.SetReelNameLength(e.reelNameLen)
+	e.events.SetCDLPrecision(e.cdlPrecision)
+
 	// Write header
 	if err := e.writeHeader(t); err != nil {
 		return err
 	}
 
-	// Get video tracks (EDL supports only one video track)
+	// Record timecodes are offset by the timeline start
+	start := e.timelineStart(t)
+
+	// Get video tracks (EDL supports only one video track, plus the layers
+	// the decoder places overlapping events on, and a track of keyed clips
+	// layered over it)
 	videoTracks := t.VideoTracks()
-	if len(videoTracks) > 1 {
-		return &EncodeError{Message: "EDL format supports only one video track"}
+	var keys []*keySpan
+	for i, track := range videoTracks {
+		if i == 0 || isLayerTrack(track) {
+			continue
+		}
+		trackKeys, err := e.keySpans(track, start)
+		if err != nil {
+			return err
+		}
+		if trackKeys == nil || keys != nil {
+			return &EncodeError{Message: "EDL format supports only one video track"}
+		}
+		keys = trackKeys
 	}
 
 	// Get audio tracks
 	audioTracks := t.AudioTracks()
+	audioTypes := make([]TrackType, len(audioTracks))
+	for i, track := range audioTracks {
+		audioTypes[i] = audioTrackType(track, i)
+	}
+
+	// Clips decoded from the same multi-channel event are written back as
+	// that one event
+	e.linked = nil
+	if e.preserveEvents {
+		var tracks []*gotio.Track
+		for i, track := range videoTracks {
+			if i == 0 || isLayerTrack(track) {
+				tracks = append(tracks, track)
+			}
+		}
+		e.linked = linkedEvents(tracks, audioTracks, audioTypes)
+	}
 
 	eventNumber := 1
 
-	// Write video track events
-	if len(videoTracks) > 0 {
-		track := videoTracks[0]
+	// Write video track events, with the events of layered tracks after
+	// those of the track below
+	for i, track := range videoTracks {
 		var err error
-		eventNumber, err = e.writeTrackEvents(track, TrackTypeVideo, eventNumber)
+		switch {
+		case i == 0:
+			eventNumber, err = e.writeTrackEvents(track, TrackTypeVideo, eventNumber, start, keys)
+		case isLayerTrack(track):
+			eventNumber, err = e.writeTrackEvents(track, TrackTypeVideo, eventNumber, start, nil)
+		}
 		if err != nil {
 			return err
 		}
@@ -80,19 +190,8 @@ func (e *Encoder) Encode(t *gotio.Timeline) error {
 
 	// Write audio track events
 	for i, track := range audioTracks {
-		trackType := TrackTypeAudio
-		if i == 0 {
-			trackType = TrackTypeAudio1
-		} else if i == 1 {
-			trackType = TrackTypeAudio2
-		} else if i == 2 {
-			trackType = TrackTypeAudio3
-		} else if i == 3 {
-			trackType = TrackTypeAudio4
-		}
-
 		var err error
-		eventNumber, err = e.writeTrackEvents(track, trackType, eventNumber)
+		eventNumber, err = e.writeTrackEvents(track, audioTypes[i], eventNumber, start, nil)
 		if err != nil {
 			return err
 		}
@@ -101,6 +200,18 @@ func (e *Encoder) Encode(t *gotio.Timeline) error {
 	return nil
 }
 
+// timelineStart returns the record time the timeline starts at: the record
+// start set on the encoder, else the timeline's global start time, else zero.
+func (e *Encoder) timelineStart(t *gotio.Timeline) opentime.RationalTime {
+	if e.recordStart != nil {
+		return e.recordStart.RescaledTo(e.rate)
+	}
+	if start := t.GlobalStartTime(); start != nil {
+		return start.RescaledTo(e.rate)
+	}
+	return opentime.NewRationalTime(0, e.rate)
+}
+
 // writeHeader writes the EDL header.
 func (e *Encoder) writeHeader(t *gotio.Timeline) error {
 	title := t.Name()
@@ -108,169 +219,999 @@ func (e *Encoder) writeHeader(t *gotio.Timeline) error {
 		title = "Timeline"
 	}
 
-	_, err := fmt.Fprintf(e.w, "TITLE: %s\n", title)
-	if err != nil {
-		return err
+	// FCM is DROP FRAME for 29.97/59.94, NON-DROP FRAME otherwise. Header
+	// comments kept from a decoded EDL are written back.
+	return e.events.WriteHeader(title, isDropFrameRate(e.rate), headerComments(t))
+}
+
+// isLayerTrack reports whether a video track is a layer of overlapping
+// events placed above the first video track by the decoder, as recorded in
+// its cmx_3600 track metadata. Key tracks are not layer tracks.
+func isLayerTrack(track *gotio.Track) bool {
+	source, ok := track.Metadata()["cmx_3600"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	layer, _ := metadataFloat(source["layer"])
+	if layer <= 1 || source["track_type"] != string(TrackTypeVideo) {
+		return false
+	}
+	for _, child := range track.Children() {
+		if clip, ok := child.(*gotio.Clip); ok {
+			if _, keyed := clip.Metadata()["key"]; keyed {
+				return false
+			}
+		}
 	}
+	return true
+}
+
+// audioTrackNameRegex matches the names DefaultTrackNamer gives audio tracks,
+// such as A3 or A3.2, capturing the channel number.
+var audioTrackNameRegex = regexp.MustCompile(`^(?i)A(\d+)(?:\.\d+)?$`)
 
-	// Write FCM (Frame Count Mode) - NON-DROP FRAME by default
-	_, err = fmt.Fprintf(e.w, "FCM: NON-DROP FRAME\n\n")
-	return err
+// audioTrackType returns the track type an audio track is written on: the
+// track type in the cmx_3600 track metadata set by the decoder, else the
+// channel in the track name, else the channel numbered by the position of
+// the track among the audio tracks.
+func audioTrackType(track *gotio.Track, index int) TrackType {
+	if source, ok := track.Metadata()["cmx_3600"].(map[string]interface{}); ok {
+		if trackType, ok := source["track_type"].(string); ok {
+			channels, err := TrackType(trackType).Channels()
+			if err == nil && !channels.Video && len(channels.Audio) == 1 {
+				return AudioTrackType(channels.Audio[0])
+			}
+		}
+	}
+	if matches := audioTrackNameRegex.FindStringSubmatch(strings.TrimSpace(track.Name())); matches != nil {
+		if n, err := strconv.Atoi(matches[1]); err == nil && n > 0 {
+			return AudioTrackType(n)
+		}
+	}
+	return AudioTrackType(index + 1)
 }
 
-// writeTrackEvents writes all events for a track.
-func (e *Encoder) writeTrackEvents(track *gotio.Track, trackType TrackType, startEventNum int) (int, error) {
+// linkedEvent is a multi-channel event decoded into linked clips on several
+// tracks.
+type linkedEvent struct {
+	channels ChannelSet // Channels of the tracks holding the linked clips
+	written  bool       // Whether the event has been written
+}
+
+// linkedEvents returns the multi-channel events whose clips, linked by the
+// link_id metadata set by the decoder, are on more than one of the video and
+// audio tracks, keyed by link id.
+func linkedEvents(videoTracks, audioTracks []*gotio.Track, audioTypes []TrackType) map[string]*linkedEvent {
+	linked := make(map[string]*linkedEvent)
+	tracks := map[*gotio.Track]TrackType{}
+	for _, track := range videoTracks {
+		tracks[track] = TrackTypeVideo
+	}
+	for i, track := range audioTracks {
+		tracks[track] = audioTypes[i]
+	}
+
+	count := make(map[string]int)
+	for track, trackType := range tracks {
+		channels, err := trackType.Channels()
+		if err != nil {
+			continue
+		}
+		for _, child := range track.Children() {
+			id := clipLinkID(child)
+			if id == "" {
+				continue
+			}
+			event, ok := linked[id]
+			if !ok {
+				event = &linkedEvent{}
+				linked[id] = event
+			}
+			event.channels.Video = event.channels.Video || channels.Video
+			for _, n := range channels.Audio {
+				event.channels = event.channels.WithAudio(n)
+			}
+			count[id]++
+		}
+	}
+
+	for id := range linked {
+		if count[id] < 2 {
+			delete(linked, id)
+		}
+	}
+	return linked
+}
+
+// clipLinkID returns the link id of a clip decoded from a multi-channel
+// event, or "" for any other item.
+func clipLinkID(item gotio.Composable) string {
+	clip, ok := item.(*gotio.Clip)
+	if !ok {
+		return ""
+	}
+	id, _ := clip.Metadata()["link_id"].(string)
+	return id
+}
+
+// headerComments returns the header comment lines stored in the timeline
+// metadata by the decoder.
+func headerComments(t *gotio.Timeline) []string {
+	return metadataStrings(t.Metadata()["header_comments"])
+}
+
+// sourceEvent returns the event number, comment lines and unrecognised lines
+// stored in the cmx_3600 metadata of a clip by the decoder.
+func sourceEvent(clip *gotio.Clip) (int, []string, []string) {
+	source, ok := clip.Metadata()["cmx_3600"].(map[string]interface{})
+	if !ok {
+		return 0, nil, nil
+	}
+
+	number := 0
+	switch n := source["event_number"].(type) {
+	case int:
+		number = n
+	case int64:
+		number = int(n)
+	case float64:
+		number = int(n)
+	}
+	return number, metadataStrings(source["comments"]), metadataStrings(source["unknown_lines"])
+}
+
+// metadataStrings returns a list of strings from metadata, which holds a
+// []interface{} once it has been through JSON.
+func metadataStrings(value interface{}) []string {
+	switch values := value.(type) {
+	case []string:
+		return values
+	case []interface{}:
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			if str, ok := v.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+		return strs
+	}
+	return nil
+}
+
+// clipCDL returns the ASC CDL in the cdl metadata of a clip. The decoder
+// keeps slope, offset, power and saturation at the top level, while the
+// OpenTimelineIO Python adapter nests slope, offset and power under asc_sop
+// and names the saturation asc_sat. Values missing from the metadata are
+// left at the identity grade.
+func clipCDL(clip *gotio.Clip) *ASCCDL {
+	metadata, ok := clip.Metadata()["cdl"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	sop := metadata
+	if nested, ok := metadata["asc_sop"].(map[string]interface{}); ok {
+		sop = nested
+	}
+
+	cdl := &ASCCDL{
+		Slope:      [3]float64{1, 1, 1},
+		Power:      [3]float64{1, 1, 1},
+		Saturation: 1,
+	}
+	found := false
+	for _, value := range []struct {
+		key    string
+		values *[3]float64
+	}{
+		{"slope", &cdl.Slope},
+		{"offset", &cdl.Offset},
+		{"power", &cdl.Power},
+	} {
+		if values, ok := metadataFloats(sop[value.key]); ok {
+			*value.values = values
+			found = true
+		}
+	}
+	for _, key := range []string{"saturation", "asc_sat"} {
+		if saturation, ok := metadataFloat(metadata[key]); ok {
+			cdl.Saturation = saturation
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return cdl
+}
+
+// metadataFloats returns the RGB values of a CDL from metadata, which holds
+// a []interface{} once it has been through JSON.
+func metadataFloats(value interface{}) ([3]float64, bool) {
+	var values [3]float64
+	switch v := value.(type) {
+	case [3]float64:
+		return v, true
+	case []float64:
+		if len(v) != len(values) {
+			return values, false
+		}
+		copy(values[:], v)
+		return values, true
+	case []interface{}:
+		if len(v) != len(values) {
+			return values, false
+		}
+		for i := range v {
+			f, ok := metadataFloat(v[i])
+			if !ok {
+				return values, false
+			}
+			values[i] = f
+		}
+		return values, true
+	}
+	return values, false
+}
+
+// metadataFloat returns a number from metadata.
+func metadataFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// writeTrackEvents writes all events for a track, with record times starting
+// at start. Clips under keys are split so that each key is written over its
+// background as a KB/K event pair.
+func (e *Encoder) writeTrackEvents(track *gotio.Track, trackType TrackType, startEventNum int, start opentime.RationalTime, keys []*keySpan) (int, error) {
 	eventNumber := startEventNum
-	recordTime := opentime.NewRationalTime(0, e.rate)
+	recordTime := start
+
+	// Track markers are placed by record time and written under the event
+	// they fall within
+	trackMarkers := e.placeMarkers(track, start, nil)
+
+	// The clip immediately before the current item, used as the outgoing
+	// side of a dissolve or wipe
+	var previous *clipSpan
 
 	children := track.Children()
 	for i := 0; i < len(children); i++ {
-		child := children[i]
+		switch child := children[i].(type) {
+		case *gotio.Gap:
+			duration, err := child.Duration()
+			if err != nil {
+				return eventNumber, err
+			}
 
-		// Handle gaps
-		if gap, ok := child.(*gotio.Gap); ok {
-			duration, err := gap.Duration()
+			// A gap holding markers is written as black, so that the
+			// markers have an event to be written under
+			span := &clipSpan{
+				reelName:   e.generators.BlackReel(),
+				sourceIn:   opentime.NewRationalTime(0, e.rate),
+				sourceOut:  duration,
+				recordIn:   recordTime,
+				recordOut:  recordTime.Add(duration),
+				timeScalar: 1,
+			}
+			span.markers = e.placeMarkers(child, recordTime, nil)
+			span.markers = append(span.markers, e.markersWithin(trackMarkers, span.recordIn, span.recordOut)...)
+			recordTime = span.recordOut
+			previous = nil
+			if len(span.markers) == 0 && !e.gapsAsBlack {
+				continue
+			}
+
+			// A following transition fades up from black, so the black
+			// ends where the transition begins
+			recordOut := span.recordOut
+			if i+1 < len(children) {
+				if transition, ok := children[i+1].(*gotio.Transition); ok {
+					recordOut = recordOut.Sub(transition.InOffset().RescaledTo(e.rate))
+				}
+			}
+			if e.frames(recordOut.Sub(span.recordIn)) <= 0 {
+				continue
+			}
+
+			event := EDLEvent{
+				EventNumber: eventNumber,
+				ReelName:    span.reelName,
+				TrackType:   trackType,
+				EditType:    EditTypeCut,
+			}
+			eventNumber, err = e.writeClipEvent(event, span, span.recordIn, recordOut, keys)
 			if err != nil {
 				return eventNumber, err
 			}
-			recordTime = recordTime.Add(duration)
-			continue
+
+		case *gotio.Transition:
+			// Transitions are written together with the clip that follows
+			// them; with no clip after, they fade to black
+			if i+1 < len(children) {
+				if _, ok := children[i+1].(*gotio.Clip); ok {
+					continue
+				}
+			}
+
+			inOffset := child.InOffset().RescaledTo(e.rate)
+			duration := inOffset.Add(child.OutOffset().RescaledTo(e.rate))
+			recordIn := recordTime.Sub(inOffset)
+			editType, wipeCode := transitionEditType(child, nil)
+
+			if err := e.events.WriteEvent(EDLEvent{
+				EventNumber:        eventNumber,
+				ReelName:           e.generators.BlackReel(),
+				TrackType:          trackType,
+				EditType:           editType,
+				SourceIn:           e.formatTimecode(opentime.NewRationalTime(0, e.rate)),
+				SourceOut:          e.formatTimecode(duration),
+				RecordIn:           e.formatTimecode(recordIn),
+				RecordOut:          e.formatTimecode(recordIn.Add(duration)),
+				TransitionDuration: e.frames(duration),
+				WipeCode:           wipeCode,
+				Outgoing:           e.outgoingEvent(previous, eventNumber, trackType, inOffset, recordIn),
+			}); err != nil {
+				return eventNumber, err
+			}
+
+			eventNumber++
+			previous = nil
+
+		case *gotio.Clip:
+			span, err := e.clipSpan(child, recordTime)
+			if err != nil {
+				return eventNumber, err
+			}
+			span.markers = append(span.markers, e.markersWithin(trackMarkers, span.recordIn, span.recordOut)...)
+			recordTime = span.recordOut
+
+			// Clips decoded from an EDL keep their event number and lines
+			var commentLines, unknownLines []string
+			if e.preserveEvents {
+				var number int
+				number, commentLines, unknownLines = sourceEvent(child)
+				if number > 0 {
+					eventNumber = number
+				}
+			}
+
+			event := EDLEvent{
+				EventNumber:  eventNumber,
+				ReelName:     span.reelName,
+				TrackType:    trackType,
+				EditType:     EditTypeCut,
+				ClipName:     child.Name(),
+				FilePath:     span.filePath,
+				ASCCDL:       span.cdl,
+				CommentLines: commentLines,
+				UnknownLines: unknownLines,
+			}
+
+			// The clips of a multi-channel event are written as one event
+			// with the first, and skipped on the tracks after
+			if linked := e.linked[clipLinkID(child)]; linked != nil {
+				if linked.written {
+					previous = span
+					continue
+				}
+				if field, _, err := strictTrackField(linked.channels); err == nil {
+					linked.written = true
+					event.TrackType = TrackType(field)
+					event.Channels = linked.channels
+				}
+			}
+
+			// Comments other than those read into clip fields are kept
+			// only in the lines as written
+			var kept EDLEvent
+			for _, line := range commentLines {
+				parseCommentLine(&kept, line)
+			}
+			event.Comment = kept.Comment
+			recordIn, recordOut := span.recordIn, span.recordOut
+
+			// A following transition starts before the cut point, so the
+			// cut line ends where the transition begins
+			if i+1 < len(children) {
+				if transition, ok := children[i+1].(*gotio.Transition); ok {
+					recordOut = recordOut.Sub(transition.InOffset().RescaledTo(e.rate))
+				}
+			}
+
+			// A preceding transition makes this clip the incoming side of an
+			// outgoing/incoming event pair starting at the transition start
+			var incoming *gotio.Transition
+			if i > 0 {
+				incoming, _ = children[i-1].(*gotio.Transition)
+			}
+			if incoming != nil {
+				inOffset := incoming.InOffset().RescaledTo(e.rate)
+				recordIn = recordIn.Sub(inOffset)
+
+				event.EditType, event.WipeCode = transitionEditType(incoming, child)
+				event.TransitionDuration = e.frames(inOffset.Add(incoming.OutOffset().RescaledTo(e.rate)))
+				event.Outgoing = e.outgoingEvent(previous, eventNumber, trackType, inOffset, recordIn)
+			} else if e.frames(recordOut.Sub(recordIn)) <= 0 {
+				// The whole clip is covered by the following transition
+				previous = span
+				continue
+			}
+
+			eventNumber, err = e.writeClipEvent(event, span, recordIn, recordOut, keys)
+			if err != nil {
+				return eventNumber, err
+			}
+			previous = span
+		}
+	}
+
+	return eventNumber, nil
+}
+
+// clipSpan is a clip resolved to source and record times.
+type clipSpan struct {
+	reelName   string
+	clipName   string
+	filePath   string
+	sourceIn   opentime.RationalTime
+	sourceOut  opentime.RationalTime
+	recordIn   opentime.RationalTime
+	recordOut  opentime.RationalTime
+	timeScalar float64 // Source frames played per record frame
+	retime     retimeMode
+	markers    []placedMarker
+	cdl        *ASCCDL
+}
+
+// placedMarker is a marker placed at a record time.
+type placedMarker struct {
+	recordTime opentime.RationalTime
+	marker     Marker
+}
+
+// retimeMode is the way the source of a clip is retimed.
+type retimeMode int
+
+const (
+	retimeNone retimeMode = iota
+	retimeSpeed
+	retimeFitToFill
+	retimeFreeze
+)
+
+// sourceAt returns the source time played at a record time. Record times
+// outside the clip, such as the start of an incoming transition, are
+// extrapolated.
+func (c *clipSpan) sourceAt(recordTime opentime.RationalTime) opentime.RationalTime {
+	offset := recordTime.Sub(c.recordIn)
+	return c.sourceIn.Add(opentime.NewRationalTime(offset.Value()*c.timeScalar, offset.Rate()))
+}
+
+// clipSpan resolves the source and record range of a clip placed at recordIn.
+func (e *Encoder) clipSpan(clip *gotio.Clip, recordIn opentime.RationalTime) (*clipSpan, error) {
+	// Get clip duration and source range
+	duration, err := clip.Duration()
+	if err != nil {
+		return nil, err
+	}
+
+	sourceRange := clip.SourceRange()
+	if sourceRange == nil {
+		// Use available range if no source range
+		ar, err := clip.AvailableRange()
+		if err != nil {
+			return nil, err
 		}
+		sourceRange = &ar
+	}
 
-		// Handle clips
-		clip, ok := child.(*gotio.Clip)
+	reelName, filePath := e.clipReel(clip)
+
+	// A clip with an effect that cannot be written is written without its
+	// time effects
+	timeScalar, mode, err := clipRetime(clip)
+	if err != nil {
+		warning, ok := err.(*EncodeError)
 		if !ok {
-			// Skip non-clip, non-gap items
-			continue
+			return nil, err
 		}
+		e.warnings = append(e.warnings, warning)
+		timeScalar, mode = 1, retimeNone
+	}
 
-		// Get clip duration and source range
-		duration, err := clip.Duration()
-		if err != nil {
-			return eventNumber, err
+	sourceIn := sourceRange.StartTime()
+	span := &clipSpan{
+		reelName:   reelName,
+		clipName:   clip.Name(),
+		filePath:   filePath,
+		sourceIn:   sourceIn,
+		sourceOut:  sourceIn.Add(opentime.NewRationalTime(duration.Value()*timeScalar, duration.Rate())),
+		recordIn:   recordIn,
+		recordOut:  recordIn.Add(duration),
+		timeScalar: timeScalar,
+		retime:     mode,
+		cdl:        clipCDL(clip),
+	}
+
+	// Clip markers are in source time, and keep their source timecode
+	span.markers = e.placeMarkers(clip, recordIn, span)
+	return span, nil
+}
+
+// clipReel returns the reel written for a clip in the encoder's style, and
+// the media path written with it. The path is left out when the style does
+// not write paths, or when it is the reel name itself.
+func (e *Encoder) clipReel(clip *gotio.Clip) (string, string) {
+	rules := e.style.rules()
+	reelName := clipReel(clip, e.generators)
+
+	filePath := ""
+	if extRef, ok := clip.MediaReference().(*gotio.ExternalReference); ok && rules.writePaths && extRef.TargetURL() != reelName {
+		filePath = extRef.TargetURL()
+	}
+
+	// Premiere identifies media by clip name, on the auxiliary source reel
+	if _, ok := clip.MediaReference().(*gotio.GeneratorReference); rules.auxReels && !ok {
+		reelName = e.generators.AuxReel()
+	}
+	reelName = SanitizeReelName(reelName, e.reelNameLen)
+	if rules.upperReels {
+		reelName = strings.ToUpper(reelName)
+	}
+	return reelName, filePath
+}
+
+// clipReel returns the reel name of a clip: the reel it was decoded from,
+// kept in its cmx_3600 metadata, or else the name of its media reference.
+// Generator clips are written with the reel of their generator kind, and
+// clips without media as the auxiliary source.
+func clipReel(clip *gotio.Clip, generators GeneratorTable) string {
+	mediaRef := clip.MediaReference()
+	if generator, ok := mediaRef.(*gotio.GeneratorReference); ok {
+		return generators.ReelForKind(generator.GeneratorKind())
+	}
+	if source, ok := clip.Metadata()["cmx_3600"].(map[string]interface{}); ok {
+		if reelName, ok := source["reel"].(string); ok && reelName != "" {
+			return reelName
 		}
+	}
 
-		sourceRange := clip.SourceRange()
-		if sourceRange == nil {
-			// Use available range if no source range
-			ar, err := clip.AvailableRange()
-			if err != nil {
-				return eventNumber, err
+	var reelName string
+	switch mediaRef := mediaRef.(type) {
+	case nil:
+	case *gotio.ExternalReference:
+		reelName = mediaRef.Name()
+		if reelName == "" {
+			reelName = mediaRef.TargetURL()
+		}
+	default:
+		reelName = mediaRef.Name()
+	}
+
+	if reelName == "" {
+		return generators.AuxReel()
+	}
+	return reelName
+}
+
+// recordAt returns the record time at which a source time is played. Every
+// source time of a freeze frame is placed at the start of the clip.
+func (c *clipSpan) recordAt(sourceTime opentime.RationalTime) opentime.RationalTime {
+	if c.timeScalar == 0 {
+		return c.recordIn
+	}
+	offset := sourceTime.Sub(c.sourceIn)
+	return c.recordIn.Add(opentime.NewRationalTime(offset.Value()/c.timeScalar, offset.Rate()))
+}
+
+// clipRetime returns the time scalar of a clip's time effects, and how the
+// clip is retimed. Stacked time warps are combined. Any other effect cannot
+// be written to an EDL and is an *EncodeError.
+func clipRetime(clip *gotio.Clip) (float64, retimeMode, error) {
+	timeScalar := 1.0
+	mode := retimeNone
+	for _, effect := range clip.Effects() {
+		switch effect := effect.(type) {
+		case *gotio.FreezeFrame:
+			timeScalar = 0
+		case *gotio.LinearTimeWarp:
+			timeScalar *= effect.TimeScalar()
+			// The decoder names the time warp of a fit to fill event,
+			// which is written without an M2 line
+			if effect.Name() == "FitToFill" && mode == retimeNone {
+				mode = retimeFitToFill
+			} else {
+				mode = retimeSpeed
+			}
+		default:
+			return 0, retimeNone, &EncodeError{
+				Field:   "effect",
+				Message: fmt.Sprintf("clip '%s' has an effect that cannot be written to an EDL: %s", clip.Name(), effect.Name()),
 			}
-			sourceRange = &ar
 		}
+	}
 
-		sourceIn := sourceRange.StartTime()
-		sourceOut := sourceIn.Add(duration)
-		recordIn := recordTime
-		recordOut := recordTime.Add(duration)
+	if timeScalar == 0 {
+		return 0, retimeFreeze, nil
+	}
+	if timeScalar == 1 {
+		return 1, retimeNone, nil
+	}
+	return timeScalar, mode, nil
+}
 
-		// Get reel name from media reference
-		reelName := "AX"
-		if mediaRef := clip.MediaReference(); mediaRef != nil {
-			reelName = mediaRef.Name()
-			if reelName == "" {
-				if extRef, ok := mediaRef.(*gotio.ExternalReference); ok {
-					reelName = extRef.TargetURL()
-				}
+// keySpan is a keyed clip on the video track above the background.
+type keySpan struct {
+	*clipSpan
+	editType     EditType
+	fadeDuration int
+}
+
+// keySpans resolves the clips of a key track, with record times starting at
+// start. It returns nil if the track holds no clips, or any clip without the
+// key metadata set by the decoder.
+func (e *Encoder) keySpans(track *gotio.Track, start opentime.RationalTime) ([]*keySpan, error) {
+	var keys []*keySpan
+	recordTime := start
+
+	for _, child := range track.Children() {
+		switch child := child.(type) {
+		case *gotio.Gap:
+			duration, err := child.Duration()
+			if err != nil {
+				return nil, err
+			}
+			recordTime = recordTime.Add(duration)
+
+		case *gotio.Clip:
+			key, ok := child.Metadata()["key"].(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+
+			span, err := e.clipSpan(child, recordTime)
+			if err != nil {
+				return nil, err
+			}
+			recordTime = span.recordOut
+
+			editType := EditTypeKey
+			if keyType, _ := key["type"].(string); EditType(keyType) == EditTypeKeyOut {
+				editType = EditTypeKeyOut
 			}
+			fadeDuration := 0
+			switch duration := key["fade_duration"].(type) {
+			case int:
+				fadeDuration = duration
+			case int64:
+				fadeDuration = int(duration)
+			case float64:
+				fadeDuration = int(duration)
+			}
+
+			keys = append(keys, &keySpan{clipSpan: span, editType: editType, fadeDuration: fadeDuration})
+
+		default:
+			return nil, nil
 		}
-		reelName = SanitizeReelName(reelName, e.reelNameLen)
+	}
+
+	return keys, nil
+}
 
-		// Determine edit type
-		editType := EditTypeCut
-		transitionDuration := 0
+// writeClipEvent writes the event for a clip spanning recordIn to recordOut,
+// split around any keys layered over it. Keyed sections are written as a KB
+// background line followed by the key line, sharing an event number. Only
+// the first section keeps the event's transition. It returns the next event
+// number.
+func (e *Encoder) writeClipEvent(event EDLEvent, span *clipSpan, recordIn, recordOut opentime.RationalTime, keys []*keySpan) (int, error) {
+	eventNumber := event.EventNumber
+	cursor := recordIn
+	first := true
 
-		// Check if next child is a transition
-		if i+1 < len(children) {
-			if transition, ok := children[i+1].(*gotio.Transition); ok {
-				transitionType := transition.TransitionType()
-				if transitionType == "SMPTE_Dissolve" {
-					editType = EditTypeDissolve
-					transDur := transition.OutOffset()
-					transitionDuration = int(transDur.Value())
-				}
-				// Skip the transition in the next iteration
-				i++
+	// section returns the part of event between from and to
+	section := func(from, to opentime.RationalTime) EDLEvent {
+		part := event
+		part.EventNumber = eventNumber
+		if !first {
+			part.EditType = EditTypeCut
+			part.TransitionDuration = 0
+			part.WipeCode = ""
+			part.Outgoing = nil
+			part.CommentLines = nil
+			part.UnknownLines = nil
+		}
+		e.setSource(&part, span, from, to)
+		part.Markers = e.sectionMarkers(span, from, to, recordOut)
+		part.RecordIn = e.formatTimecode(from)
+		part.RecordOut = e.formatTimecode(to)
+		first = false
+		return part
+	}
+
+	for _, key := range keys {
+		from, to := key.recordIn, key.recordOut
+		if e.frames(cursor.Sub(from)) > 0 {
+			from = cursor
+		}
+		if e.frames(to.Sub(recordOut)) > 0 {
+			to = recordOut
+		}
+		if e.frames(to.Sub(from)) <= 0 {
+			continue
+		}
+
+		if e.frames(from.Sub(cursor)) > 0 {
+			if err := e.events.WriteEvent(section(cursor, from)); err != nil {
+				return eventNumber, err
 			}
+			eventNumber++
+		}
+
+		background := section(from, to)
+		if background.Outgoing != nil {
+			return eventNumber, &EncodeError{Message: fmt.Sprintf("key at %s starts inside a transition", background.RecordIn)}
 		}
+		background.EditType = EditTypeKeyBackground
 
-		// Write the event
-		if err := e.writeEvent(EDLEvent{
+		foreground := EDLEvent{
 			EventNumber:        eventNumber,
-			ReelName:           reelName,
-			TrackType:          trackType,
-			EditType:           editType,
-			SourceIn:           e.formatTimecode(sourceIn),
-			SourceOut:          e.formatTimecode(sourceOut),
-			RecordIn:           e.formatTimecode(recordIn),
-			RecordOut:          e.formatTimecode(recordOut),
-			ClipName:           clip.Name(),
-			TransitionDuration: transitionDuration,
-		}); err != nil {
+			ReelName:           key.reelName,
+			TrackType:          event.TrackType,
+			EditType:           key.editType,
+			RecordIn:           e.formatTimecode(from),
+			RecordOut:          e.formatTimecode(to),
+			ClipName:           key.clipName,
+			FilePath:           key.filePath,
+			ASCCDL:             key.cdl,
+			TransitionDuration: key.fadeDuration,
+			Outgoing:           &background,
+		}
+		e.setSource(&foreground, key.clipSpan, from, to)
+		foreground.Markers = e.sectionMarkers(key.clipSpan, from, to, key.recordOut)
+		if err := e.events.WriteEvent(foreground); err != nil {
 			return eventNumber, err
 		}
+		eventNumber++
+		cursor = to
+	}
 
+	if first || e.frames(recordOut.Sub(cursor)) > 0 {
+		if err := e.events.WriteEvent(section(cursor, recordOut)); err != nil {
+			return eventNumber, err
+		}
 		eventNumber++
-		recordTime = recordOut
 	}
 
 	return eventNumber, nil
 }
 
-// writeEvent writes a single EDL event.
-func (e *Encoder) writeEvent(event EDLEvent) error {
-	// Write event line
-	eventLine := fmt.Sprintf("%03d  %-8s %s    %-2s",
-		event.EventNumber,
-		event.ReelName,
-		event.TrackType,
-		event.EditType,
-	)
+// setSource sets the source timecodes of an event for the part of a clip
+// between record times from and to. A retimed clip gets an M2 line giving
+// its speed and the source timecode it starts from. Reverse motion plays
+// from the source out back to the source in, and a freeze frame holds a
+// single source frame. A fit to fill clip is given by its source and record
+// durations alone.
+func (e *Encoder) setSource(event *EDLEvent, span *clipSpan, from, to opentime.RationalTime) {
+	sourceIn, sourceOut := span.sourceAt(from), span.sourceAt(to)
+	entry := sourceIn
 
-	// Add transition duration if applicable
-	if event.EditType == EditTypeDissolve && event.TransitionDuration > 0 {
-		eventLine += fmt.Sprintf("   %03d", event.TransitionDuration)
+	switch span.retime {
+	case retimeFreeze:
+		sourceOut = sourceIn.Add(opentime.NewRationalTime(1, e.rate))
+		event.FreezeFrame = true
+	case retimeSpeed:
+		if span.timeScalar < 0 {
+			sourceIn, sourceOut = sourceOut, sourceIn
+		}
 	}
 
-	_, err := fmt.Fprintf(e.w, "%s\n", eventLine)
-	if err != nil {
-		return err
+	if span.retime == retimeSpeed || span.retime == retimeFreeze {
+		event.SpeedEffect = &SpeedEffect{
+			Name:     event.ReelName,
+			Speed:    span.timeScalar * e.rate,
+			Timecode: e.formatTimecode(entry),
+		}
 	}
+	event.SourceIn = e.formatTimecode(sourceIn)
+	event.SourceOut = e.formatTimecode(sourceOut)
+}
 
-	// Write timecode line
-	timecodeLine := fmt.Sprintf("     %s %s %s %s",
-		event.SourceIn,
-		event.SourceOut,
-		event.RecordIn,
-		event.RecordOut,
-	)
+// markedItem is a timeline item that can hold markers.
+type markedItem interface {
+	Markers() []*gotio.Marker
+}
 
-	_, err = fmt.Fprintf(e.w, "%s\n", timecodeLine)
-	if err != nil {
-		return err
+// placeMarkers places the markers of an item starting at record time start.
+// The markers of a clip are in its source time, and are placed through the
+// clip's span; those of gaps and tracks are relative to their start.
+func (e *Encoder) placeMarkers(item markedItem, start opentime.RationalTime, span *clipSpan) []placedMarker {
+	var placed []placedMarker
+	for _, marker := range item.Markers() {
+		markedStart := marker.MarkedRange().StartTime()
+		comment := marker.Comment()
+		if comment == "" {
+			comment = marker.Name()
+		}
+
+		p := placedMarker{
+			recordTime: start.Add(markedStart),
+			marker: Marker{
+				Color:    e.markerColor(marker),
+				Comment:  strings.Join(strings.Fields(comment), " "),
+				Duration: e.frames(marker.MarkedRange().Duration()),
+			},
+		}
+		if span != nil {
+			p.recordTime = span.recordAt(markedStart)
+			p.marker.Timecode = e.formatTimecode(markedStart)
+		}
+		placed = append(placed, p)
 	}
+	return placed
+}
 
-	// Write clip name comment if present
-	if event.ClipName != "" {
-		_, err = fmt.Fprintf(e.w, "* FROM CLIP NAME: %s\n", event.ClipName)
-		if err != nil {
-			return err
+// markersWithin returns the markers placed from recordIn up to recordOut.
+func (e *Encoder) markersWithin(markers []placedMarker, recordIn, recordOut opentime.RationalTime) []placedMarker {
+	var within []placedMarker
+	for _, p := range markers {
+		if e.frames(p.recordTime.Sub(recordIn)) >= 0 && e.frames(recordOut.Sub(p.recordTime)) > 0 {
+			within = append(within, p)
+		}
+	}
+	return within
+}
+
+// sectionMarkers returns the LOC lines of a clip's markers that fall in the
+// section of the clip from record time from to to. Markers past the end of
+// the clip are written under its last section. Markers placed by record
+// time get the source timecode played at that time.
+func (e *Encoder) sectionMarkers(span *clipSpan, from, to, clipOut opentime.RationalTime) []Marker {
+	var markers []Marker
+	for _, p := range span.markers {
+		before := e.frames(p.recordTime.Sub(from)) < 0 && e.frames(from.Sub(span.recordIn)) > 0
+		after := e.frames(p.recordTime.Sub(to)) >= 0 && e.frames(clipOut.Sub(to)) > 0
+		if before || after {
+			continue
+		}
+
+		marker := p.marker
+		if marker.Timecode == "" {
+			marker.Timecode = e.formatTimecode(span.sourceAt(p.recordTime))
 		}
+		markers = append(markers, marker)
 	}
+	return markers
+}
 
-	// Add blank line between events for readability
-	_, err = fmt.Fprintf(e.w, "\n")
-	return err
+// markerColors maps OpenTimelineIO marker colours to the locator colours
+// of each output style. Colours missing from a style's table are written as
+// the first colour of its vocabulary.
+var markerColors = map[OutputStyle]map[string]string{
+	OutputStyleAvid: {
+		"RED": "RED", "PINK": "MAGENTA", "ORANGE": "YELLOW", "YELLOW": "YELLOW",
+		"GREEN": "GREEN", "CYAN": "CYAN", "BLUE": "BLUE", "PURPLE": "MAGENTA",
+		"MAGENTA": "MAGENTA", "BLACK": "BLACK", "WHITE": "WHITE",
+	},
+	OutputStylePremiere: {
+		"RED": "RED", "PINK": "PURPLE", "ORANGE": "ORANGE", "YELLOW": "YELLOW",
+		"GREEN": "GREEN", "CYAN": "CYAN", "BLUE": "BLUE", "PURPLE": "PURPLE",
+		"MAGENTA": "PURPLE", "BLACK": "WHITE", "WHITE": "WHITE",
+	},
+	OutputStyleResolve: {
+		"RED": "ResolveColorRed", "PINK": "ResolveColorPink", "ORANGE": "ResolveColorSand",
+		"YELLOW": "ResolveColorYellow", "GREEN": "ResolveColorGreen", "CYAN": "ResolveColorCyan",
+		"BLUE": "ResolveColorBlue", "PURPLE": "ResolveColorPurple", "MAGENTA": "ResolveColorFuchsia",
+		"BLACK": "ResolveColorCocoa", "WHITE": "ResolveColorCream",
+	},
+}
+
+// markerColor returns the locator colour written for a marker in the
+// encoder's style. Nucoda and strict CMX 3600 output use the Avid colours. A
+// marker without a colour, or with one the style has no match for, is
+// written in the style's red. Resolve output keeps the Resolve colour a
+// marker was decoded with, as long as the marker colour still matches it.
+func (e *Encoder) markerColor(marker *gotio.Marker) string {
+	color := strings.ToUpper(string(marker.Color()))
+	if e.style == OutputStyleResolve {
+		if resolveColor, ok := marker.Metadata()["resolve_color"].(string); ok && strings.HasPrefix(resolveColor, resolveColorPrefix) {
+			if decoded, _ := markerColorName(resolveColor); decoded == color {
+				return resolveColor
+			}
+		}
+	}
+
+	colors, ok := markerColors[e.style]
+	if !ok {
+		colors = markerColors[OutputStyleAvid]
+	}
+	if mapped, ok := colors[color]; ok {
+		return mapped
+	}
+	return colors["RED"]
+}
+
+// outgoingEvent builds the zero length cut line that opens a dissolve or wipe
+// pair at recordIn. The outgoing source is the previous clip, trimmed to the
+// start of the transition, or black when the transition has no clip before it.
+func (e *Encoder) outgoingEvent(previous *clipSpan, eventNumber int, trackType TrackType, inOffset, recordIn opentime.RationalTime) *EDLEvent {
+	outgoing := &EDLEvent{
+		EventNumber: eventNumber,
+		ReelName:    e.generators.BlackReel(),
+		TrackType:   trackType,
+		EditType:    EditTypeCut,
+		SourceIn:    e.formatTimecode(opentime.NewRationalTime(0, e.rate)),
+		SourceOut:   e.formatTimecode(opentime.NewRationalTime(0, e.rate)),
+		RecordIn:    e.formatTimecode(recordIn),
+		RecordOut:   e.formatTimecode(recordIn),
+	}
+
+	if previous != nil {
+		sourceOut := e.formatTimecode(previous.sourceAt(previous.recordOut.Sub(inOffset)))
+		outgoing.ReelName = previous.reelName
+		outgoing.ClipName = previous.clipName
+		outgoing.SourceIn = sourceOut
+		outgoing.SourceOut = sourceOut
+	}
+
+	return outgoing
+}
+
+// wipeCodeRegex matches an SMPTE wipe code such as W001.
+var wipeCodeRegex = regexp.MustCompile(`^W\d{3}$`)
+
+// transitionEditType returns the edit type and wipe code used to write a
+// transition. Custom transitions are written as wipes when a wipe code is
+// found in the transition name or in wipe_code metadata on the transition or
+// the incoming clip, as set by the decoder. Anything else is a dissolve.
+func transitionEditType(transition *gotio.Transition, incoming *gotio.Clip) (EditType, string) {
+	if transition.TransitionType() != gotio.TransitionTypeCustom {
+		return EditTypeDissolve, ""
+	}
+
+	if wipeCodeRegex.MatchString(transition.Name()) {
+		return EditTypeWipe, transition.Name()
+	}
+	if code, ok := transition.Metadata()["wipe_code"].(string); ok && wipeCodeRegex.MatchString(code) {
+		return EditTypeWipe, code
+	}
+	if incoming != nil {
+		if code, ok := incoming.Metadata()["wipe_code"].(string); ok && wipeCodeRegex.MatchString(code) {
+			return EditTypeWipe, code
+		}
+	}
+
+	return EditTypeDissolve, ""
+}
+
+// frames returns a duration as a whole number of frames at the encoder rate.
+func (e *Encoder) frames(t opentime.RationalTime) int {
+	return int(math.Round(t.RescaledTo(e.rate).Value()))
 }
 
 // formatTimecode formats a RationalTime as a timecode string.
 func (e *Encoder) formatTimecode(t opentime.RationalTime) string {
-	// Rescale to the encoder's rate
-	rescaled := t.RescaledTo(e.rate)
+	return toTimecode(t, e.rate)
+}
+
+// toTimecode formats a RationalTime as a timecode string at the given rate.
+func toTimecode(t opentime.RationalTime, rate float64) string {
+	// Rescale to the target rate
+	rescaled := t.RescaledTo(rate)
 
 	// Convert to timecode
-	tc, err := rescaled.ToTimecode(e.rate, opentime.InferFromRate)
+	tc, err := rescaled.ToTimecode(rate, opentime.InferFromRate)
 	if err != nil {
 		// Fallback to 00:00:00:00
 		return "00:00:00:00"
@@ -278,7 +1219,7 @@ func (e *Encoder) formatTimecode(t opentime.RationalTime) string {
 
 	// EDL uses colon separator (not semicolon) for non-drop frame
 	// Replace semicolon with colon if not drop frame
-	if !isDropFrameRate(e.rate) {
+	if !isDropFrameRate(rate) {
 		tc = strings.ReplaceAll(tc, ";", ":")
 	}
 
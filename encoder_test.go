@@ -5,6 +5,9 @@ package cmx3600
 
 import (
 	"bytes"
+	"fmt"
+	"os"
+	"slices"
 	"strings"
 	"testing"
 
@@ -228,6 +231,33 @@ func TestEncoder_ReelNameSanitization(t *testing.T) {
 	if !strings.Contains(output, "VeryLong") {
 		t.Error("Output missing truncated reel name")
 	}
+
+	// The style's limit applies unless a length is set, before or after
+	// the style
+	for _, tt := range []struct {
+		name   string
+		length int
+		want   string
+	}{
+		{"style", 0, "VeryLongReelNameThatExceedsLimit"},
+		{"length", 12, "VeryLongReel "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+			if tt.length > 0 {
+				encoder.SetReelNameLength(tt.length)
+			}
+			encoder.SetStyle(OutputStyleNucoda)
+			if err := encoder.Encode(timeline); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !strings.Contains(buf.String(), "001  "+tt.want) {
+				t.Errorf("Expected reel %q:\n%s", tt.want, buf.String())
+			}
+		})
+	}
 }
 
 func TestEncoder_EmptyTimeline(t *testing.T) {
@@ -347,3 +377,1290 @@ func TestEncoder_RoundTrip(t *testing.T) {
 		t.Errorf("Expected duration %v, got %v", expectedDuration, duration)
 	}
 }
+
+func TestEncoder_DropFrameHeader(t *testing.T) {
+	timeline := gotio.NewTimeline("Drop Frame", nil, nil)
+	track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 29.97),
+		opentime.NewRationalTime(17982, 29.97), // 10 minutes drop frame
+	)
+	mediaRef := gotio.NewExternalReference("Clip", "Clip", &sourceRange, nil)
+	clip := gotio.NewClip("Clip", mediaRef, &sourceRange, nil, nil, nil, "", nil)
+	track.AppendChild(clip)
+	timeline.Tracks().AppendChild(track)
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(29.97)
+
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "FCM: DROP FRAME") {
+		t.Errorf("Output missing drop frame FCM line:\n%s", output)
+	}
+	if !strings.Contains(output, "00:10:00;00") {
+		t.Errorf("Output missing drop frame timecode:\n%s", output)
+	}
+
+	// Decoding the output should give back the same duration
+	decoder := NewDecoder(strings.NewReader(output))
+	decoder.SetRate(29.97)
+	decoded, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	duration, err := decoded.VideoTracks()[0].Children()[0].(*gotio.Clip).Duration()
+	if err != nil {
+		t.Fatalf("Duration() error = %v", err)
+	}
+	if duration.Value() != 17982 {
+		t.Errorf("Expected round trip duration 17982, got %v", duration.Value())
+	}
+}
+
+func TestEncoder_DissolvePair(t *testing.T) {
+	timeline := gotio.NewTimeline("Dissolve Test", nil, nil)
+	track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+
+	sourceRange1 := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(48, 24),
+	)
+	mediaRef1 := gotio.NewExternalReference("ReelA", "ReelA", &sourceRange1, nil)
+	clip1 := gotio.NewClip("ShotA", mediaRef1, &sourceRange1, nil, nil, nil, "", nil)
+
+	// 10 frame dissolve centred on the cut
+	transition := gotio.NewTransition(
+		"",
+		gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(5, 24),
+		opentime.NewRationalTime(5, 24),
+		nil,
+	)
+
+	sourceRange2 := opentime.NewTimeRange(
+		opentime.NewRationalTime(240, 24),
+		opentime.NewRationalTime(48, 24),
+	)
+	mediaRef2 := gotio.NewExternalReference("ReelB", "ReelB", &sourceRange2, nil)
+	clip2 := gotio.NewClip("ShotB", mediaRef2, &sourceRange2, nil, nil, nil, "", nil)
+
+	track.AppendChild(clip1)
+	track.AppendChild(transition)
+	track.AppendChild(clip2)
+	timeline.Tracks().AppendChild(track)
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		"001  ReelA    V     C        00:00:00:00 00:00:01:19 00:00:00:00 00:00:01:19\n* FROM CLIP NAME: ShotA\n",
+		"002  ReelA    V     C        00:00:01:19 00:00:01:19 00:00:01:19 00:00:01:19\n" +
+			"002  ReelB    V     D    010 00:00:09:19 00:00:12:00 00:00:01:19 00:00:04:00\n" +
+			"* FROM CLIP NAME: ShotA\n* TO CLIP NAME: ShotB\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output missing:\n%s\ngot:\n%s", want, output)
+		}
+	}
+
+	// Decoding the output gives back the original structure
+	decoder := NewDecoder(strings.NewReader(output))
+	decoder.SetRate(24.0)
+	decoded, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	children := decoded.VideoTracks()[0].Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 children, got %d", len(children))
+	}
+	for i, want := range []float64{48, 48} {
+		clip := children[i*2].(*gotio.Clip)
+		if clip.SourceRange().Duration().Value() != want {
+			t.Errorf("Clip %d: expected duration %v, got %v", i, want, clip.SourceRange().Duration().Value())
+		}
+	}
+	if clip := children[2].(*gotio.Clip); clip.SourceRange().StartTime().Value() != 240 {
+		t.Errorf("Expected incoming source start 240, got %v", clip.SourceRange().StartTime().Value())
+	}
+	decodedTransition := children[1].(*gotio.Transition)
+	if decodedTransition.InOffset().Value() != 5 || decodedTransition.OutOffset().Value() != 5 {
+		t.Errorf("Expected offsets 5/5, got %v/%v", decodedTransition.InOffset().Value(), decodedTransition.OutOffset().Value())
+	}
+}
+
+func TestEncoder_Wipe(t *testing.T) {
+	tests := []struct {
+		name       string
+		transition *gotio.Transition
+		clipMeta   map[string]interface{}
+	}{
+		{
+			name: "wipe code name",
+			transition: gotio.NewTransition(
+				"W025",
+				gotio.TransitionTypeCustom,
+				opentime.NewRationalTime(15, 24),
+				opentime.NewRationalTime(15, 24),
+				nil,
+			),
+		},
+		{
+			name: "decoder metadata",
+			transition: gotio.NewTransition(
+				"",
+				gotio.TransitionTypeCustom,
+				opentime.NewRationalTime(15, 24),
+				opentime.NewRationalTime(15, 24),
+				nil,
+			),
+			clipMeta: map[string]interface{}{"wipe_code": "W025"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeline := gotio.NewTimeline("Wipe Test", nil, nil)
+			track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+
+			sourceRange := opentime.NewTimeRange(
+				opentime.NewRationalTime(0, 24),
+				opentime.NewRationalTime(120, 24),
+			)
+			mediaRef1 := gotio.NewExternalReference("ReelA", "ReelA", &sourceRange, nil)
+			mediaRef2 := gotio.NewExternalReference("ReelB", "ReelB", &sourceRange, nil)
+			track.AppendChild(gotio.NewClip("ShotA", mediaRef1, &sourceRange, nil, nil, nil, "", nil))
+			track.AppendChild(tt.transition)
+			track.AppendChild(gotio.NewClip("ShotB", mediaRef2, &sourceRange, tt.clipMeta, nil, nil, "", nil))
+			timeline.Tracks().AppendChild(track)
+
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+
+			if err := encoder.Encode(timeline); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			output := buf.String()
+			if !strings.Contains(output, "002  ReelB    V     W025 030 00:00:09:19") {
+				t.Errorf("Output missing wipe event line:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestEncoder_FadeToAndFromBlack(t *testing.T) {
+	timeline := gotio.NewTimeline("Fade Test", nil, nil)
+	track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(120, 24),
+	)
+	mediaRef := gotio.NewExternalReference("ReelA", "ReelA", &sourceRange, nil)
+
+	track.AppendChild(gotio.NewTransition(
+		"",
+		gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(24, 24),
+		nil,
+	))
+	track.AppendChild(gotio.NewClip("ShotA", mediaRef, &sourceRange, nil, nil, nil, "", nil))
+	track.AppendChild(gotio.NewTransition(
+		"",
+		gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(24, 24),
+		opentime.NewRationalTime(0, 24),
+		nil,
+	))
+	timeline.Tracks().AppendChild(track)
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		// Fade up from black
+		"001  BL       V     C        00:00:00:00 00:00:00:00 00:00:00:00 00:00:00:00\n" +
+			"001  ReelA    V     D    024 00:00:00:00 00:00:04:00 00:00:00:00 00:00:04:00\n",
+		// Fade down to black
+		"002  ReelA    V     C        00:00:04:00 00:00:04:00 00:00:04:00 00:00:04:00\n" +
+			"002  BL       V     D    024 00:00:00:00 00:00:01:00 00:00:04:00 00:00:05:00\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output missing:\n%s\ngot:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_KeyTrack(t *testing.T) {
+	timeline := gotio.NewTimeline("Key Test", nil, nil)
+
+	background := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+	bgRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(144, 24),
+	)
+	bgRef := gotio.NewExternalReference("BG", "BG", &bgRange, nil)
+	background.AppendChild(gotio.NewClip("Background", bgRef, &bgRange, nil, nil, nil, "", nil))
+
+	keyTrack := gotio.NewTrack("V2", nil, gotio.TrackKindVideo, nil, nil)
+	keyTrack.AppendChild(gotio.NewGapWithDuration(opentime.NewRationalTime(48, 24)))
+	titleRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(48, 24),
+	)
+	titleRef := gotio.NewExternalReference("TITLE", "TITLE", &titleRange, nil)
+	keyMeta := map[string]interface{}{
+		"key": map[string]interface{}{"type": "KO", "fade_duration": 12},
+	}
+	keyTrack.AppendChild(gotio.NewClip("Title", titleRef, &titleRange, keyMeta, nil, nil, "", nil))
+
+	timeline.Tracks().AppendChild(background)
+	timeline.Tracks().AppendChild(keyTrack)
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		"001  BG       V     C        00:00:00:00 00:00:02:00 00:00:00:00 00:00:02:00\n",
+		"002  BG       V     KB       00:00:02:00 00:00:04:00 00:00:02:00 00:00:04:00\n" +
+			"002  TITLE    V     K O  012 00:00:00:00 00:00:02:00 00:00:02:00 00:00:04:00\n" +
+			"* FROM CLIP NAME: Background\n* TO CLIP NAME: Title\n",
+		"003  BG       V     C        00:00:04:00 00:00:06:00 00:00:04:00 00:00:06:00\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output missing:\n%s\ngot:\n%s", want, output)
+		}
+	}
+
+	// The key survives a round trip
+	decoder := NewDecoder(strings.NewReader(output))
+	decoder.SetRate(24.0)
+	decoded, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(decoded.VideoTracks()) != 2 {
+		t.Fatalf("Expected 2 video tracks after round trip, got %d", len(decoded.VideoTracks()))
+	}
+}
+
+func TestEncoder_StrictAudioChannels(t *testing.T) {
+	newTimeline := func(audioTracks int) *gotio.Timeline {
+		timeline := gotio.NewTimeline("Audio Channels", nil, nil)
+		sourceRange := opentime.NewTimeRange(
+			opentime.NewRationalTime(0, 24),
+			opentime.NewRationalTime(120, 24),
+		)
+		for i := 1; i <= audioTracks; i++ {
+			track := gotio.NewTrack(string(AudioTrackType(i)), nil, gotio.TrackKindAudio, nil, nil)
+			mediaRef := gotio.NewExternalReference("Audio", "Audio", &sourceRange, nil)
+			track.AppendChild(gotio.NewClip("Audio", mediaRef, &sourceRange, nil, nil, nil, "", nil))
+			timeline.Tracks().AppendChild(track)
+		}
+		return timeline
+	}
+
+	t.Run("default", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+
+		if err := encoder.Encode(newTimeline(4)); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		output := buf.String()
+		if !strings.Contains(output, "003  Audio    A3    C") {
+			t.Errorf("Expected A3 track field:\n%s", output)
+		}
+		if strings.Contains(output, "AUD") {
+			t.Errorf("Unexpected AUD line:\n%s", output)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		encoder.SetStyle(OutputStyleCMX3600)
+
+		if err := encoder.Encode(newTimeline(4)); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		output := buf.String()
+		expected := []string{
+			"001  AUDIO    A     C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00\n",
+			"002  AUDIO    A2    C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00\n",
+			"003  AUDIO    NONE  C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00\nAUD  3\n",
+			"004  AUDIO    NONE  C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00\nAUD  4\n",
+		}
+		for _, want := range expected {
+			if !strings.Contains(output, want) {
+				t.Errorf("Output missing:\n%s\ngot:\n%s", want, output)
+			}
+		}
+
+		// AUD lines decode back onto channels 3 and 4
+		decoder := NewDecoder(strings.NewReader(output))
+		decoder.SetRate(24.0)
+		decoded, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if len(decoded.AudioTracks()) != 4 {
+			t.Errorf("Expected 4 audio tracks after round trip, got %d", len(decoded.AudioTracks()))
+		}
+	})
+
+	t.Run("strict video with audio 1", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer := NewEventWriter(&buf)
+		writer.SetStyle(OutputStyleCMX3600)
+
+		event := EDLEvent{
+			EventNumber: 1,
+			ReelName:    "AX",
+			TrackType:   "A/V",
+			EditType:    EditTypeCut,
+			SourceIn:    "00:00:00:00",
+			SourceOut:   "00:00:05:00",
+			RecordIn:    "00:00:00:00",
+			RecordOut:   "00:00:05:00",
+		}
+		if err := writer.WriteEvent(event); err != nil {
+			t.Fatalf("WriteEvent() error = %v", err)
+		}
+		if !strings.HasPrefix(buf.String(), "001  AX       B     C") {
+			t.Errorf("Expected B track field:\n%s", buf.String())
+		}
+	})
+
+	t.Run("strict beyond A4", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		encoder.SetStyle(OutputStyleCMX3600)
+
+		err := encoder.Encode(newTimeline(5))
+		if _, ok := err.(*EncodeError); !ok {
+			t.Errorf("Expected EncodeError for audio channel 5, got %v", err)
+		}
+	})
+}
+
+func TestEncoder_AudioTrackChannels(t *testing.T) {
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(0, 24),
+		opentime.NewRationalTime(120, 24),
+	)
+	newTrack := func(name string, metadata map[string]interface{}) *gotio.Track {
+		track := gotio.NewTrack(name, nil, gotio.TrackKindAudio, metadata, nil)
+		mediaRef := gotio.NewExternalReference("Audio", "Audio", &sourceRange, nil)
+		track.AppendChild(gotio.NewClip("Audio", mediaRef, &sourceRange, nil, nil, nil, "", nil))
+		return track
+	}
+
+	// Channels come from the track metadata, then the track name, then the
+	// position of the track
+	timeline := gotio.NewTimeline("Audio Channels", nil, nil)
+	timeline.Tracks().AppendChild(newTrack("Music", map[string]interface{}{
+		"cmx_3600": map[string]interface{}{"track_type": "A4"},
+	}))
+	timeline.Tracks().AppendChild(newTrack("A3", nil))
+	timeline.Tracks().AppendChild(newTrack("Dialogue", nil))
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{"001  Audio    A4", "002  Audio    A3", "003  Audio    A3"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output missing %q:\n%s", want, output)
+		}
+	}
+
+	// A decoded EDL is written back on its channels, whatever its tracks
+	// are named
+	edl := `TITLE: Second Channel
+FCM: NON-DROP FRAME
+
+001  AX       A2    C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+`
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+	decoder.SetTrackNamer(func(trackType TrackType, layer int) string {
+		return "Dialogue"
+	})
+	decoded, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	buf.Reset()
+	if err := encoder.Encode(decoded); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "001  AX       A2") {
+		t.Errorf("Expected event on A2:\n%s", buf.String())
+	}
+}
+
+func TestEncoder_LayeredTracks(t *testing.T) {
+	// Event 002 is superimposed over event 001, so it is decoded onto a
+	// second video track
+	edl := `TITLE: Overlaps
+FCM: NON-DROP FRAME
+
+001  AX       V     C        01:00:00:00 01:00:10:00 00:00:00:00 00:00:10:00
+* FROM CLIP NAME: Background
+002  BX       V     C        02:00:00:00 02:00:02:00 00:00:02:00 00:00:04:00
+* FROM CLIP NAME: Superimpose
+003  CX       V     C        03:00:00:00 03:00:05:00 00:00:10:00 00:00:15:00
+* FROM CLIP NAME: Shot 3
+`
+
+	decode := func(edl string) *gotio.Timeline {
+		decoder := NewDecoder(strings.NewReader(edl))
+		decoder.SetRate(24.0)
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if len(timeline.VideoTracks()) != 2 {
+			t.Fatalf("Expected 2 video tracks, got %d", len(timeline.VideoTracks()))
+		}
+		return timeline
+	}
+	clipNames := func(timeline *gotio.Timeline) string {
+		var names []string
+		for _, track := range timeline.VideoTracks() {
+			for _, child := range track.Children() {
+				if clip, ok := child.(*gotio.Clip); ok {
+					names = append(names, track.Name()+":"+clip.Name())
+				}
+			}
+		}
+		return strings.Join(names, ",")
+	}
+
+	timeline := decode(edl)
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	// The layered event is written after the events of the track below,
+	// and decoded back onto the layer
+	output := buf.String()
+	if !strings.Contains(normalizeWhitespace(output), "003 BX V C 02:00:00:00 02:00:02:00 00:00:02:00 00:00:04:00") {
+		t.Errorf("Expected the layered event last:\n%s", output)
+	}
+	want := "V:Background,V:Shot 3,V2:Superimpose"
+	if got := clipNames(decode(output)); got != want {
+		t.Errorf("Expected clips %s after round trip, got %s", want, got)
+	}
+
+	// A layer read from JSON as an int64 is still a layer
+	timeline.VideoTracks()[1].Metadata()["cmx_3600"].(map[string]interface{})["layer"] = int64(2)
+	buf.Reset()
+	encoder = NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if got := normalizeWhitespace(buf.String()); !strings.Contains(got, "003 BX V C 02:00:00:00 02:00:02:00 00:00:02:00 00:00:04:00") {
+		t.Errorf("Expected the int64 layered event last:\n%s", buf.String())
+	}
+}
+
+func TestEncoder_HeaderRoundTrip(t *testing.T) {
+	edl := `TITLE: Reel 1 Conform
+FCM: NON-DROP FRAME
+* PROJECT: Feature
+* EDITOR: Assistant
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Shot 1
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	header := "TITLE: Reel 1 Conform\nFCM: NON-DROP FRAME\n* PROJECT: Feature\n* EDITOR: Assistant\n\n001  "
+	if !strings.HasPrefix(output, header) {
+		t.Errorf("Expected header:\n%s\ngot:\n%s", header, output)
+	}
+}
+
+func TestEncoder_RecordStart(t *testing.T) {
+	edl := `TITLE: Start Time
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:59:50:00 00:59:55:00
+* FROM CLIP NAME: Shot 1
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	t.Run("global start time", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		if !strings.Contains(buf.String(), "00:00:00:00 00:00:05:00 00:59:50:00 00:59:55:00") {
+			t.Errorf("Expected record times from the global start time:\n%s", buf.String())
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		encoder.SetRecordStart(opentime.NewRationalTime(86400, 24))
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		if !strings.Contains(buf.String(), "00:00:00:00 00:00:05:00 01:00:00:00 01:00:05:00") {
+			t.Errorf("Expected record times from the record start:\n%s", buf.String())
+		}
+	})
+}
+
+func TestEncoder_PreserveEvents(t *testing.T) {
+	edl := `TITLE: Supplier Cut
+FCM: NON-DROP FRAME
+* DELIVERED BY: Supplier
+
+010  A001     V     C
+     01:00:00:00 01:00:05:00 01:00:00:00 01:00:05:00
+* FROM CLIP NAME: Shot 1
+* SHOT: 0010
+VENDOR LINE
+
+020  A002     V     C
+     02:00:00:00 02:00:05:00 01:00:05:00 01:00:10:00
+*FROM CLIP NAME:  Shot 2
+* SOURCE FILE: A002.mov
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	clip := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	source, ok := clip.Metadata()["cmx_3600"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected cmx_3600 clip metadata")
+	}
+	if source["event_number"] != 10 {
+		t.Errorf("Expected event number 10, got %v", source["event_number"])
+	}
+	if lines, _ := source["unknown_lines"].([]string); strings.Join(lines, "\n") != "VENDOR LINE" {
+		t.Errorf("Expected unknown line 'VENDOR LINE', got %v", source["unknown_lines"])
+	}
+
+	t.Run("default", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		output := buf.String()
+		if !strings.Contains(output, "001  A001") || strings.Contains(output, "VENDOR LINE") {
+			t.Errorf("Expected renumbered events without source lines:\n%s", output)
+		}
+	})
+
+	t.Run("preserve", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		encoder.SetPreserveEvents(true)
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		if normalizeWhitespace(buf.String()) != normalizeWhitespace(edl) {
+			t.Errorf("Round trip mismatch:\nwant:\n%s\ngot:\n%s", edl, buf.String())
+		}
+	})
+
+	t.Run("edited", func(t *testing.T) {
+		timeline.VideoTracks()[0].Children()[1].(*gotio.Clip).SetName("Shot 2B")
+
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		encoder.SetPreserveEvents(true)
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		// The edited event has its comments written again from its
+		// fields, while the other keeps its lines as written
+		output := buf.String()
+		for _, want := range []string{
+			"* FROM CLIP NAME: Shot 1\n* SHOT: 0010\nVENDOR LINE\n",
+			"* FROM CLIP NAME: Shot 2B\n* FROM CLIP: A002.mov\n",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Output missing:\n%s\ngot:\n%s", want, output)
+			}
+		}
+	})
+}
+
+func TestEncoder_PreserveMultiChannelEvents(t *testing.T) {
+	edl, err := os.ReadFile("testdata/multi_audio.edl")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	decoder := NewDecoder(bytes.NewReader(edl))
+	decoder.SetRate(24.0)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(timeline.AudioTracks()) != 3 {
+		t.Fatalf("Expected 3 audio tracks, got %d", len(timeline.AudioTracks()))
+	}
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	encoder.SetPreserveEvents(true)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	// The linked clips are written back as the one AA event with its AUD
+	// line and comment
+	output := buf.String()
+	want := "001 AX AA C 00:00:00:00 00:56:55:22 00:00:00:00 00:56:55:22 AUD 3 * FROM CLIP NAME: AX"
+	if !strings.HasSuffix(normalizeWhitespace(output), want) || strings.Count(output, "001  ") != 1 {
+		t.Errorf("Expected one multi-channel event:\n%s\ngot:\n%s", want, output)
+	}
+
+	var events []EDLEvent
+	for event, err := range NewEventReader(strings.NewReader(output)).Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 1 || !slices.Equal(events[0].Channels.Audio, []int{1, 2, 3}) {
+		t.Errorf("Expected one event on audio 1 to 3, got %+v", events)
+	}
+}
+
+func TestEncoder_MotionEffects(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		want  []string
+	}{
+		{
+			name: "double speed",
+			lines: `001  AX       V     C        01:00:00:00 01:00:02:00 00:00:00:00 00:00:01:00
+M2   AX       048.0                01:00:00:00`,
+			want: []string{
+				"001 AX V C 01:00:00:00 01:00:02:00 00:00:00:00 00:00:01:00",
+				"M2 AX 048.0 01:00:00:00",
+			},
+		},
+		{
+			name: "reverse",
+			lines: `001  AX       V     C        01:00:04:00 01:00:05:00 00:00:00:00 00:00:01:00
+M2   AX       -024.0               01:00:05:00`,
+			want: []string{
+				"001 AX V C 01:00:04:00 01:00:05:00 00:00:00:00 00:00:01:00",
+				"M2 AX -24.0 01:00:05:00",
+			},
+		},
+		{
+			name: "freeze frame",
+			lines: `001  AX       V     C        01:00:03:00 01:00:03:01 00:00:00:00 00:00:02:00
+M2   AX       000.0                01:00:03:00`,
+			want: []string{
+				"001 AX V C 01:00:03:00 01:00:03:01 00:00:00:00 00:00:02:00",
+				"M2 AX 000.0 01:00:03:00",
+				"* FREEZE FRAME",
+			},
+		},
+		{
+			name:  "fit to fill",
+			lines: `001  AX       V     C        01:00:00:00 01:00:03:00 00:00:00:00 00:00:02:00`,
+			want: []string{
+				"001 AX V C 01:00:00:00 01:00:03:00 00:00:00:00 00:00:02:00",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edl := "TITLE: Motion Effects\nFCM: NON-DROP FRAME\n\n" + tt.lines + "\n"
+
+			decoder := NewDecoder(strings.NewReader(edl))
+			decoder.SetRate(24.0)
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+			if err := encoder.Encode(timeline); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			output := normalizeWhitespace(buf.String())
+			for _, line := range tt.want {
+				if !strings.Contains(output, line) {
+					t.Errorf("Expected line %q in output:\n%s", line, buf.String())
+				}
+			}
+			if len(tt.want) == 1 && strings.Contains(output, "M2") {
+				t.Errorf("Expected no M2 line in output:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+// unsupportedEffect is an effect the EDL format has no equivalent for.
+type unsupportedEffect struct {
+	*gotio.LinearTimeWarp
+}
+
+func TestEncoder_UnsupportedEffect(t *testing.T) {
+	timeline := gotio.NewTimeline("Effect Test", nil, nil)
+	track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(86400, 24), opentime.NewRationalTime(48, 24))
+	ref := gotio.NewExternalReference("AX", "AX", &sourceRange, nil)
+	effects := []gotio.Effect{unsupportedEffect{gotio.NewLinearTimeWarp("Blur", "Blur", 2, nil)}}
+	track.AppendChild(gotio.NewClip("Shot", ref, &sourceRange, nil, effects, nil, "", nil))
+	timeline.Tracks().AppendChild(track)
+
+	// The clip is written without the effect, which is reported
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := normalizeWhitespace(buf.String())
+	if want := "001 AX V C 01:00:00:00 01:00:02:00 00:00:00:00 00:00:02:00"; !strings.Contains(output, want) {
+		t.Errorf("Expected line %q in output:\n%s", want, buf.String())
+	}
+	if strings.Contains(output, "M2") {
+		t.Errorf("Expected no M2 line in output:\n%s", buf.String())
+	}
+	warnings := encoder.Warnings()
+	if len(warnings) != 1 || warnings[0].Field != "effect" {
+		t.Errorf("Expected one effect warning, got %v", warnings)
+	}
+
+	// Warnings are reset by the next Encode
+	if err := encoder.Encode(gotio.NewTimeline("Empty", nil, nil)); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if warnings := encoder.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+}
+
+func TestEncoder_Markers(t *testing.T) {
+	second := func(seconds float64) opentime.RationalTime {
+		return opentime.NewRationalTime(seconds*24, 24)
+	}
+	marker := func(name string, start opentime.RationalTime, color gotio.MarkerColor, comment string) *gotio.Marker {
+		return gotio.NewMarker(name, opentime.NewTimeRange(start, second(0)), color, comment, nil)
+	}
+	// setMarkers sets the markers of a gap or track
+	setMarkers := func(item interface{}, markers ...*gotio.Marker) {
+		marked, ok := item.(interface{ SetMarkers([]*gotio.Marker) })
+		if !ok {
+			t.Fatalf("%T does not support markers", item)
+		}
+		marked.SetMarkers(markers)
+	}
+
+	build := func() *gotio.Timeline {
+		timeline := gotio.NewTimeline("Marker Test", nil, nil)
+		track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+
+		// Clip markers are in source time
+		rangeA := opentime.NewTimeRange(second(3600), second(5))
+		refA := gotio.NewExternalReference("AX", "AX", &rangeA, nil)
+		// A marker without a color is written in the default color
+		clipMarkers := []*gotio.Marker{
+			marker("", second(3601), gotio.MarkerColor("PINK"), "Fix this"),
+			marker("", second(3603), "", "No color"),
+		}
+		track.AppendChild(gotio.NewClip("ShotA", refA, &rangeA, nil, nil, clipMarkers, "", nil))
+
+		gap := gotio.NewGapWithDuration(second(2))
+		setMarkers(gap, marker("Gap note", second(1), gotio.MarkerColor("GREEN"), ""))
+		track.AppendChild(gap)
+
+		rangeB := opentime.NewTimeRange(second(0), second(5))
+		refB := gotio.NewExternalReference("BX", "BX", &rangeB, nil)
+		track.AppendChild(gotio.NewClip("ShotB", refB, &rangeB, nil, nil, nil, "", nil))
+
+		// Track markers are in record time, and fall within the second clip
+		setMarkers(track, marker("", second(8), gotio.MarkerColor("ORANGE"), "Track note"))
+		timeline.Tracks().AppendChild(track)
+		return timeline
+	}
+
+	tests := []struct {
+		style OutputStyle
+		want  []string
+	}{
+		{
+			style: OutputStyleAvid,
+			want: []string{
+				"001 AX V C 01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00 * FROM CLIP NAME: ShotA * LOC: 01:00:01:00 MAGENTA Fix this",
+				"002 BL V C 00:00:00:00 00:00:02:00 00:00:05:00 00:00:07:00 * LOC: 00:00:01:00 GREEN Gap note",
+				"003 BX V C 00:00:00:00 00:00:05:00 00:00:07:00 00:00:12:00 * FROM CLIP NAME: ShotB * LOC: 00:00:01:00 YELLOW Track note",
+				"* LOC: 01:00:03:00 RED No color",
+			},
+		},
+		{
+			style: OutputStylePremiere,
+			want: []string{
+				"* LOC: 01:00:01:00 PURPLE Fix this",
+				"* LOC: 00:00:01:00 GREEN Gap note",
+				"* LOC: 00:00:01:00 ORANGE Track note",
+				"* LOC: 01:00:03:00 RED No color",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.style), func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+			encoder.SetStyle(tt.style)
+			if err := encoder.Encode(build()); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			output := normalizeWhitespace(buf.String())
+			for _, line := range tt.want {
+				if !strings.Contains(output, line) {
+					t.Errorf("Expected %q in output:\n%s", line, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestEncoder_ASCCDL(t *testing.T) {
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(120, 24))
+
+	tests := []struct {
+		name      string
+		metadata  map[string]interface{}
+		style     OutputStyle
+		precision int
+		want      []string
+	}{
+		{
+			name: "decoder metadata",
+			metadata: map[string]interface{}{
+				"slope":      [3]float64{1.5, 1, 0.9},
+				"offset":     [3]float64{0.1, -0.2, 0},
+				"power":      [3]float64{1, 1.1, 0.95},
+				"saturation": 0.9,
+			},
+			style:     OutputStyleAvid,
+			precision: -1,
+			want:      []string{"*ASC_SOP (1.5 1 0.9)(0.1 -0.2 0)(1 1.1 0.95)", "*ASC_SAT 0.9"},
+		},
+		{
+			// The Python adapter metadata, as read back from JSON
+			name: "python adapter metadata",
+			metadata: map[string]interface{}{
+				"asc_sop": map[string]interface{}{
+					"slope":  []interface{}{1.2, 1.0, 1.0},
+					"offset": []interface{}{0.0, 0.05, 0.0},
+					"power":  []interface{}{1.0, 1.0, 0.8},
+				},
+				"asc_sat": 1.1,
+			},
+			style:     OutputStylePremiere,
+			precision: 4,
+			want: []string{
+				"* ASC_SOP (1.2000 1.0000 1.0000)(0.0000 0.0500 0.0000)(1.0000 1.0000 0.8000)",
+				"* ASC_SAT 1.1000",
+			},
+		},
+		{
+			name:      "saturation only",
+			metadata:  map[string]interface{}{"asc_sat": 0.5},
+			style:     OutputStyleNucoda,
+			precision: 1,
+			want:      []string{"* ASC_SOP (1.0 1.0 1.0)(0.0 0.0 0.0)(1.0 1.0 1.0)", "* ASC_SAT 0.5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeline := gotio.NewTimeline("CDL Test", nil, nil)
+			track := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+			mediaRef := gotio.NewExternalReference("AX", "AX", &sourceRange, nil)
+			metadata := map[string]interface{}{"cdl": tt.metadata}
+			track.AppendChild(gotio.NewClip("Graded", mediaRef, &sourceRange, metadata, nil, nil, "", nil))
+			timeline.Tracks().AppendChild(track)
+
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+			encoder.SetStyle(tt.style)
+			encoder.SetCDLPrecision(tt.precision)
+			if err := encoder.Encode(timeline); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			for _, line := range tt.want {
+				if !strings.Contains(buf.String(), line+"\n") {
+					t.Errorf("Expected line %q in output:\n%s", line, buf.String())
+				}
+			}
+
+			// The grade reads back from the written EDL
+			decoder := NewDecoder(strings.NewReader(buf.String()))
+			decoder.SetRate(24.0)
+			decoded, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			clips := decoded.VideoTracks()[0].Children()
+			if _, ok := clips[0].(*gotio.Clip).Metadata()["cdl"]; !ok {
+				t.Errorf("Expected cdl metadata on decoded clip")
+			}
+		})
+	}
+}
+
+func TestEncoder_GeneratorReels(t *testing.T) {
+	edl := `TITLE: Generators
+FCM: NON-DROP FRAME
+
+001  BLACK    V     C        00:00:00:00 00:00:01:00 00:00:00:00 00:00:01:00
+002  BARS     V     C        00:00:00:00 00:00:01:00 00:00:01:00 00:00:02:00
+003  SLUG     V     C        00:00:00:00 00:00:01:00 00:00:02:00 00:00:03:00
+004  AX       V     C        01:00:00:00 01:00:01:00 00:00:05:00 00:00:06:00
+* FROM CLIP NAME: Shot 1
+`
+
+	tests := []struct {
+		name        string
+		table       GeneratorTable
+		gapsAsBlack bool
+		want        []string
+	}{
+		{
+			name: "default",
+			want: []string{
+				"001 BL V C 00:00:00:00 00:00:01:00 00:00:00:00 00:00:01:00",
+				"002 BARS V C 00:00:00:00 00:00:01:00 00:00:01:00 00:00:02:00",
+				"003 SLUG V C 00:00:00:00 00:00:01:00 00:00:02:00 00:00:03:00",
+				"004 AX V C 01:00:00:00 01:00:01:00 00:00:05:00 00:00:06:00",
+			},
+		},
+		{
+			name:        "gaps as black",
+			gapsAsBlack: true,
+			want: []string{
+				"004 BL V C 00:00:00:00 00:00:02:00 00:00:03:00 00:00:05:00",
+				"005 AX V C 01:00:00:00 01:00:01:00 00:00:05:00 00:00:06:00",
+			},
+		},
+		{
+			// Generator kinds missing from the table are written as the
+			// auxiliary source
+			name: "custom table",
+			table: GeneratorTable{
+				{Reel: "BLACK", Kind: "black"},
+				{Reel: "SMPTE", Aliases: []string{"BARS"}, Kind: "SMPTEBars"},
+				{Reel: "AUX"},
+			},
+			gapsAsBlack: true,
+			want: []string{
+				"001 BLACK V C 00:00:00:00 00:00:01:00 00:00:00:00 00:00:01:00",
+				"002 SMPTE V C 00:00:00:00 00:00:01:00 00:00:01:00 00:00:02:00",
+				"003 AUX V C 00:00:00:00 00:00:01:00 00:00:02:00 00:00:03:00",
+				"004 BLACK V C 00:00:00:00 00:00:02:00 00:00:03:00 00:00:05:00",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(edl))
+			decoder.SetRate(24.0)
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+			encoder.SetGeneratorTable(tt.table)
+			encoder.SetGapsAsBlack(tt.gapsAsBlack)
+			if err := encoder.Encode(timeline); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			output := normalizeWhitespace(buf.String())
+			for _, line := range tt.want {
+				if !strings.Contains(output, line) {
+					t.Errorf("Expected line %q in output:\n%s", line, buf.String())
+				}
+			}
+			if !tt.gapsAsBlack && strings.Contains(output, "005") {
+				t.Errorf("Expected no event for the gap:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestEncoder_OutputStyles(t *testing.T) {
+	second := func(seconds float64) opentime.RationalTime {
+		return opentime.NewRationalTime(seconds*24, 24)
+	}
+
+	build := func() *gotio.Timeline {
+		timeline := gotio.NewTimeline("Style Test", nil, nil)
+		video := gotio.NewTrack("V", nil, gotio.TrackKindVideo, nil, nil)
+
+		rangeA := opentime.NewTimeRange(second(3600), second(5))
+		refA := gotio.NewExternalReference("A001C003_long", "/media/A001C003.mov", &rangeA, nil)
+		markers := []*gotio.Marker{gotio.NewMarker("", opentime.NewTimeRange(second(3601), second(0)), gotio.MarkerColor("RED"), "Fix this", nil)}
+		video.AppendChild(gotio.NewClip("Shot 1", refA, &rangeA, nil, nil, markers, "", nil))
+		video.AppendChild(gotio.NewTransition("", gotio.TransitionTypeSMPTEDissolve, second(0.5), second(0.5), nil))
+
+		rangeB := opentime.NewTimeRange(second(7200), second(5))
+		refB := gotio.NewExternalReference("b002", "b002", &rangeB, nil)
+		video.AppendChild(gotio.NewClip("Shot 2", refB, &rangeB, nil, nil, nil, "", nil))
+
+		rangeBlack := opentime.NewTimeRange(second(0), second(1))
+		black := gotio.NewGeneratorReference("black", "black", nil, &rangeBlack, nil)
+		video.AppendChild(gotio.NewClip("", black, &rangeBlack, nil, nil, nil, "", nil))
+		timeline.Tracks().AppendChild(video)
+
+		audio := gotio.NewTrack("A1", nil, gotio.TrackKindAudio, nil, nil)
+		rangeC := opentime.NewTimeRange(second(0), second(10))
+		refC := gotio.NewExternalReference("SOUND_01", "/media/sound_01.wav", &rangeC, nil)
+		audio.AppendChild(gotio.NewClip("Sound", refC, &rangeC, nil, nil, nil, "", nil))
+		timeline.Tracks().AppendChild(audio)
+		return timeline
+	}
+
+	for _, style := range []OutputStyle{OutputStyleAvid, OutputStyleNucoda, OutputStylePremiere, OutputStyleCMX3600, OutputStyleResolve} {
+		t.Run(string(style), func(t *testing.T) {
+			golden, err := os.ReadFile("testdata/style_" + string(style) + ".edl")
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetRate(24.0)
+			encoder.SetStyle(style)
+			if err := encoder.Encode(build()); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+
+			if buf.String() != string(golden) {
+				t.Errorf("Output does not match testdata/style_%s.edl:\nwant:\n%s\ngot:\n%s", style, golden, buf.String())
+			}
+
+			// Every style reads back
+			decoder := NewDecoder(bytes.NewReader(golden))
+			decoder.SetRate(24.0)
+			decoded, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if len(decoded.VideoTracks()) != 1 || len(decoded.AudioTracks()) != 1 {
+				t.Errorf("Expected 1 video and 1 audio track, got %d and %d", len(decoded.VideoTracks()), len(decoded.AudioTracks()))
+			}
+		})
+	}
+}
+
+func TestEncoder_ResolveMarkers(t *testing.T) {
+	edl := `TITLE: Timeline 1
+FCM: NON-DROP FRAME
+
+001  001      V     C        01:00:05:00 01:00:05:01 01:00:05:00 01:00:05:01
+ |C:ResolveColorBlue |M:Check focus |D:1
+
+002  002      V     C        01:00:10:00 01:00:12:00 01:00:10:00 01:00:12:00
+* SOURCE FILE: /media/A001C003.mov
+ |C:ResolveColorFuchsia |M:VFX 010 |D:48
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	// Markers keep their colour, name and duration
+	var markers []string
+	for _, child := range timeline.VideoTracks()[0].Children() {
+		clip, ok := child.(*gotio.Clip)
+		if !ok {
+			continue
+		}
+		for _, marker := range clip.Markers() {
+			markers = append(markers, fmt.Sprintf("%s %s %v", marker.Color(), marker.Comment(), marker.MarkedRange().Duration().Value()))
+		}
+	}
+	expected := []string{"BLUE Check focus 1", "MAGENTA VFX 010 48"}
+	if !slices.Equal(markers, expected) {
+		t.Errorf("Expected markers %v, got %v", expected, markers)
+	}
+
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	encoder.SetRate(24.0)
+	encoder.SetStyle(OutputStyleResolve)
+	encoder.SetRecordStart(opentime.NewRationalTime(0, 24))
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	output := buf.String()
+	for _, line := range []string{
+		"\n |C:ResolveColorBlue |M:Check focus |D:1\n",
+		"\n* SOURCE FILE: /media/A001C003.mov\n",
+		"\n |C:ResolveColorFuchsia |M:VFX 010 |D:48\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected line %q in output:\n%s", strings.TrimSpace(line), output)
+		}
+	}
+}
+
+func TestEncoder_ResolveMarkerColors(t *testing.T) {
+	// Rose, Cocoa and Lavender are read as colours shared with other
+	// Resolve colours
+	edl := `TITLE: Timeline 1
+FCM: NON-DROP FRAME
+
+001  002      V     C        01:00:10:00 01:00:12:00 01:00:10:00 01:00:12:00
+ |C:ResolveColorRose |M:Rose |D:1
+* LOC: 01:00:10:12 ResolveColorCocoa Cocoa
+* LOC: 01:00:11:00 ResolveColorLavender Lavender
+`
+
+	decoder := NewDecoder(strings.NewReader(edl))
+	decoder.SetRate(24.0)
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	encode := func(style OutputStyle) string {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		encoder.SetRate(24.0)
+		encoder.SetStyle(style)
+		if err := encoder.Encode(timeline); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	output := encode(OutputStyleResolve)
+	for _, line := range []string{
+		"\n |C:ResolveColorRose |M:Rose |D:1\n",
+		"\n* LOC: 01:00:10:12 ResolveColorCocoa Cocoa\n",
+		"\n* LOC: 01:00:11:00 ResolveColorLavender Lavender\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected line %q in output:\n%s", strings.TrimSpace(line), output)
+		}
+	}
+
+	// Other styles write the marker colour
+	if output := encode(OutputStyleAvid); !strings.Contains(output, "\n* LOC: 01:00:10:00 MAGENTA Rose\n") {
+		t.Errorf("Expected the Rose marker in MAGENTA in output:\n%s", output)
+	}
+}
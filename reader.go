@@ -0,0 +1,637 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package cmx3600
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// trackFieldRegex matches the track field of an event line.
+// TRACK is V, A, A2, A3 etc., AA (audio 1 and 2), B (audio 1 and video),
+// NONE, or an audio field followed by /V for audio with video.
+var trackFieldRegex = regexp.MustCompile(`^(V|NONE|(?:AA|B|A\d*)(?:/V)?)$`)
+
+// editTypeRegex matches the edit type field of an event line, with the
+// "K B" and "K O" forms joined up.
+var editTypeRegex = regexp.MustCompile(`^(C|D|W\d{3}|KB|KO|K)$`)
+
+// speedEffectRegex matches an M2 motion effect line.
+// Format: M2 REEL SPEED TIMECODE
+var speedEffectRegex = regexp.MustCompile(`^M2\s+(?P<name>\S+)\s+(?P<speed>-?[0-9.]+)\s+(?P<tc>\d{2}:\d{2}:\d{2}[;:]\d{2})`)
+
+// markerRegex matches a locator/marker line.
+// Format: * LOC: TIMECODE COLOR COMMENT
+var markerRegex = regexp.MustCompile(`^\*\s*LOC:\s+(\d{2}:\d{2}:\d{2}[;:]\d{2})\s+(\w*)(\s+|$)(.*)`)
+
+// resolveMarkerRegex matches a DaVinci Resolve marker line, giving the
+// colour, name and duration of a marker at the start of the event.
+var resolveMarkerRegex = regexp.MustCompile(`^\|C:(\w*)\s*\|M:(.*?)\s*\|D:(\d+)\s*$`)
+
+// ascSOPRegex matches ASC_SOP (slope, offset, power) values.
+var ascSOPRegex = regexp.MustCompile(`ASC_SOP\s*\(\s*([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)\s*\)\s*\(\s*([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)\s*\)\s*\(\s*([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)[,\s]+([-+]?[\d.]+)\s*\)`)
+
+// ascSATRegex matches ASC_SAT (saturation) value.
+var ascSATRegex = regexp.MustCompile(`ASC_SAT\s+([-+]?[\d.]+)`)
+
+// audioChannelRegex matches an AUD line assigning audio channels 3 and/or 4.
+// Format: AUD CHANNEL [CHANNEL]
+var audioChannelRegex = regexp.MustCompile(`^AUD\s+([34])(?:\s+([34]))?\s*$`)
+
+// EventReader reads the events of a CMX 3600 EDL one at a time, without
+// building a timeline.
+type EventReader struct {
+	scanner        *bufio.Scanner
+	lineNum        int
+	current        *EDLEvent // Event whose lines are being read
+	skipping       bool      // Whether the lines of a skipped event are being read
+	dropFrame      bool      // Drop frame mode of the most recent FCM line
+	fcmMode        string    // "DROP FRAME" or "NON-DROP FRAME"
+	title          string
+	headerComments []string
+	pending        *string // Line to read again before scanning the next
+	mode           DecodeMode
+	diagnostics    []Diagnostic
+	err            error
+}
+
+// NewEventReader creates a new EDL event reader.
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{
+		scanner: bufio.NewScanner(r),
+		mode:    DecodeModeDefault,
+	}
+}
+
+// SetMode sets how problems in the EDL are handled. In lenient mode events
+// that cannot be read are skipped, in strict mode any problem is an error.
+func (r *EventReader) SetMode(mode DecodeMode) {
+	r.mode = mode
+}
+
+// Diagnostics returns the problems found in the EDL so far.
+func (r *EventReader) Diagnostics() []Diagnostic {
+	return r.diagnostics
+}
+
+// Title returns the TITLE header read so far.
+func (r *EventReader) Title() string {
+	return r.title
+}
+
+// FCM returns the most recent frame count mode read, such as "DROP FRAME".
+func (r *EventReader) FCM() string {
+	return r.fcmMode
+}
+
+// HeaderComments returns the free-text lines read before the first event.
+func (r *EventReader) HeaderComments() []string {
+	return r.headerComments
+}
+
+// Read returns the next event. An event is complete once the line of the
+// following event, or the end of the EDL, has been read. Read returns io.EOF
+// when there are no more events.
+func (r *EventReader) Read() (EDLEvent, error) {
+	if r.err != nil {
+		return EDLEvent{}, r.err
+	}
+
+	for {
+		line, ok := r.nextLine()
+		if !ok {
+			break
+		}
+		event, err := r.parseLine(line)
+		if err != nil {
+			// Return the event completed before the error, if any, and the
+			// error on the next call
+			r.err = err
+			if event == nil {
+				return EDLEvent{}, err
+			}
+		}
+		if event != nil {
+			return *event, nil
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		r.err = err
+		return EDLEvent{}, err
+	}
+
+	// Return the last event
+	if r.current != nil {
+		event := *r.current
+		r.current = nil
+		return event, nil
+	}
+
+	r.err = io.EOF
+	return EDLEvent{}, io.EOF
+}
+
+// nextLine returns the line to read again, if any, or the next line of the
+// EDL.
+func (r *EventReader) nextLine() (string, bool) {
+	if r.pending != nil {
+		line := *r.pending
+		r.pending = nil
+		return line, true
+	}
+	if !r.scanner.Scan() {
+		return "", false
+	}
+	r.lineNum++
+	return r.scanner.Text(), true
+}
+
+// report records a diagnostic. It returns a *ParseError if the problem is
+// fatal in the reader's mode.
+func (r *EventReader) report(diagnostic Diagnostic) error {
+	r.diagnostics = append(r.diagnostics, diagnostic)
+	return diagnostic.check(r.mode)
+}
+
+// Events returns an iterator over the remaining events. Iteration stops
+// after the first error, which is yielded with an empty event.
+func (r *EventReader) Events() iter.Seq2[EDLEvent, error] {
+	return func(yield func(EDLEvent, error) bool) {
+		for {
+			event, err := r.Read()
+			if err == io.EOF {
+				return
+			}
+			if !yield(event, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseLine parses one line of the EDL. It returns the previous event once
+// the line of the next event shows it is complete, even if the next event
+// cannot be parsed.
+func (r *EventReader) parseLine(line string) (*EDLEvent, error) {
+	// Skip blank lines
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+
+	// Check for title line
+	if strings.HasPrefix(strings.TrimSpace(line), "TITLE:") {
+		r.title = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "TITLE:"))
+		return nil, nil
+	}
+
+	// Check for FCM (frame count mode) line
+	if strings.HasPrefix(strings.TrimSpace(line), "FCM:") {
+		// Parse FCM mode (DROP FRAME or NON-DROP FRAME)
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) == 2 {
+			r.fcmMode = strings.TrimSpace(parts[1])
+			r.dropFrame = isDropFrameMode(r.fcmMode)
+		}
+		return nil, nil
+	}
+
+	// Try to match event line
+	if fields, ok := parseEventLine(line); ok {
+		eventLine := r.lineNum
+		endLine := r.lineNum
+
+		// The timecodes may follow the event fields on the same line, or
+		// be given on the lines after it. A line that does not start with
+		// a timecode is read again as the start of whatever follows.
+		timecodes := fields.timecodes
+		for len(timecodes) < 4 {
+			next, ok := r.nextLine()
+			if !ok {
+				break
+			}
+			more := lineTimecodes(next)
+			if len(more) == 0 {
+				r.pending = &next
+				break
+			}
+			timecodes = append(timecodes, more...)
+			endLine = r.lineNum
+		}
+
+		// Parse track field. An event with an invalid track field or edit
+		// type is skipped together with its timecodes.
+		channels, err := ParseChannels(fields.track.text)
+		if err == nil && !trackFieldRegex.MatchString(fields.track.text) {
+			err = fmt.Errorf("invalid track field %q", fields.track.text)
+		}
+		if err != nil {
+			if err := r.report(Diagnostic{
+				Line:     eventLine,
+				Column:   fields.track.column,
+				Severity: SeverityError,
+				Code:     DiagnosticInvalidTrack,
+				Message:  err.Error(),
+			}); err != nil {
+				return r.current, err
+			}
+			return r.skip(), nil
+		}
+		if !editTypeRegex.MatchString(fields.editType.text) {
+			if err := r.report(Diagnostic{
+				Line:     eventLine,
+				Column:   fields.editType.column,
+				Severity: SeverityError,
+				Code:     DiagnosticInvalidEdit,
+				Message:  fmt.Sprintf("invalid edit type %q", fields.editType.text),
+			}); err != nil {
+				return r.current, err
+			}
+			return r.skip(), nil
+		}
+
+		// Without all four timecodes the event is skipped
+		if len(timecodes) < 4 {
+			if err := r.report(Diagnostic{
+				Line:     eventLine,
+				EndLine:  endLine,
+				Severity: SeverityError,
+				Code:     DiagnosticMissingTimecode,
+				Message:  "expected timecode line after event",
+			}); err != nil {
+				return r.current, err
+			}
+			return r.skip(), nil
+		}
+
+		// Extract the wipe code
+		editType := EditType(fields.editType.text)
+		wipeCode := ""
+		if len(fields.editType.text) == 4 && fields.editType.text[0] == 'W' {
+			// This is a wipe code (W###)
+			editType = EditTypeWipe
+			wipeCode = fields.editType.text
+		}
+
+		event := &EDLEvent{
+			EventNumber:        fields.number,
+			Line:               eventLine,
+			EndLine:            endLine,
+			ReelName:           fields.reel,
+			TrackType:          TrackType(fields.track.text),
+			Channels:           channels,
+			EditType:           editType,
+			TransitionDuration: fields.duration,
+			WipeCode:           wipeCode,
+			SourceIn:           timecodes[0],
+			SourceOut:          timecodes[1],
+			RecordIn:           timecodes[2],
+			RecordOut:          timecodes[3],
+			DropFrame:          r.dropFrame,
+		}
+
+		// A semicolon separator implies drop frame counting
+		for _, timecode := range timecodes[:4] {
+			if strings.Contains(timecode, ";") {
+				event.DropFrame = true
+			}
+		}
+
+		// A dissolve or wipe line that repeats the event number of the
+		// preceding cut line is the incoming side of an A/B pair; the cut
+		// line describes the outgoing source. Key lines pair with a
+		// preceding key background line in the same way.
+		var completed *EDLEvent
+		if r.current != nil {
+			transitionPair := (editType == EditTypeDissolve || editType == EditTypeWipe) &&
+				r.current.EditType == EditTypeCut
+			keyPair := editType.IsKey() && r.current.EditType == EditTypeKeyBackground
+			if (transitionPair || keyPair) &&
+				r.current.EventNumber == event.EventNumber &&
+				r.current.TrackType == event.TrackType {
+				event.Outgoing = r.current
+			} else {
+				completed = r.current
+			}
+		}
+
+		r.current = event
+		r.skipping = false
+		return completed, nil
+	}
+
+	// The lines of a skipped event are skipped with it
+	if r.skipping {
+		return nil, nil
+	}
+
+	// Check for AUD lines adding audio channels 3 and 4
+	if matches := audioChannelRegex.FindStringSubmatch(strings.TrimSpace(line)); matches != nil {
+		if r.current != nil {
+			r.current.EndLine = r.lineNum
+			for _, channel := range matches[1:] {
+				if channel != "" {
+					n, _ := strconv.Atoi(channel)
+					r.current.Channels = r.current.Channels.WithAudio(n)
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	// Check for M2 speed effect lines
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "M2") {
+		if r.current != nil {
+			r.current.EndLine = r.lineNum
+		}
+		if r.current != nil && speedEffectRegex.MatchString(trimmed) {
+			matches := speedEffectRegex.FindStringSubmatch(trimmed)
+			if len(matches) == 4 {
+				speed, _ := strconv.ParseFloat(matches[2], 64)
+				r.current.SpeedEffect = &SpeedEffect{
+					Name:     matches[1],
+					Speed:    speed,
+					Timecode: matches[3],
+				}
+			}
+		} else if r.current != nil {
+			if err := r.report(Diagnostic{
+				Line:     r.lineNum,
+				Column:   speedEffectColumn(line),
+				Severity: SeverityWarning,
+				Code:     DiagnosticInvalidSpeedEffect,
+				Message:  "ignored malformed M2 line",
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	// Check for comment lines
+	if r.current != nil {
+		trimmed := strings.TrimSpace(line)
+		r.current.EndLine = r.lineNum
+
+		// Keep the line as written, so that it can be written back verbatim
+		if strings.HasPrefix(trimmed, "*") || resolveMarkerRegex.MatchString(trimmed) {
+			r.current.CommentLines = append(r.current.CommentLines, trimmed)
+		} else {
+			r.current.UnknownLines = append(r.current.UnknownLines, trimmed)
+		}
+
+		if !parseCommentLine(r.current, trimmed) {
+			if err := r.report(Diagnostic{
+				Line:     r.lineNum,
+				Severity: SeverityWarning,
+				Code:     DiagnosticUnknownLine,
+				Message:  fmt.Sprintf("ignored unrecognised line %q", trimmed),
+			}); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		// Free-text lines before the first event are header comments
+		r.headerComments = append(r.headerComments, strings.TrimSpace(line))
+	}
+
+	return nil, nil
+}
+
+// parseCommentLine sets the fields of an event described by one of its
+// comment lines, and reports whether the line was recognised. Lines that
+// start with an asterisk and are not otherwise recognised are added to the
+// event comment.
+func parseCommentLine(event *EDLEvent, trimmed string) bool {
+	// Under an A/B transition or key pair, FROM CLIP NAME names the
+	// outgoing or background clip and TO CLIP NAME names the incoming
+	// or foreground one
+	nameTarget := event
+	if event.Outgoing != nil {
+		nameTarget = event.Outgoing
+	}
+
+	// FROM CLIP NAME: indicates the clip name
+	// Handle both "*FROM CLIP NAME:" and "* FROM CLIP NAME:"
+	if strings.HasPrefix(trimmed, "*FROM CLIP NAME:") {
+		nameTarget.ClipName = strings.TrimSpace(strings.TrimPrefix(trimmed, "*FROM CLIP NAME:"))
+	} else if strings.HasPrefix(trimmed, "* FROM CLIP NAME:") {
+		nameTarget.ClipName = strings.TrimSpace(strings.TrimPrefix(trimmed, "* FROM CLIP NAME:"))
+	} else if strings.HasPrefix(trimmed, "*TO CLIP NAME:") {
+		event.ClipName = strings.TrimSpace(strings.TrimPrefix(trimmed, "*TO CLIP NAME:"))
+	} else if strings.HasPrefix(trimmed, "* TO CLIP NAME:") {
+		event.ClipName = strings.TrimSpace(strings.TrimPrefix(trimmed, "* TO CLIP NAME:"))
+	} else if strings.HasPrefix(trimmed, "*FROM CLIP:") {
+		// FROM CLIP: for Avid style - file path
+		event.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "*FROM CLIP:"))
+	} else if strings.HasPrefix(trimmed, "* FROM CLIP:") {
+		event.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "* FROM CLIP:"))
+	} else if strings.HasPrefix(trimmed, "*FROM FILE:") {
+		// FROM FILE: for Nucoda style - file path
+		event.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "*FROM FILE:"))
+	} else if strings.HasPrefix(trimmed, "* FROM FILE:") {
+		event.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "* FROM FILE:"))
+	} else if strings.HasPrefix(trimmed, "*SOURCE FILE:") {
+		// SOURCE FILE: for Resolve style - file path
+		event.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "*SOURCE FILE:"))
+	} else if strings.HasPrefix(trimmed, "* SOURCE FILE:") {
+		event.FilePath = strings.TrimSpace(strings.TrimPrefix(trimmed, "* SOURCE FILE:"))
+	} else if strings.HasPrefix(trimmed, "* FREEZE FRAME") || strings.HasSuffix(trimmed, " FF") {
+		// Freeze frame detection
+		event.FreezeFrame = true
+	} else if markerRegex.MatchString(trimmed) {
+		// Locator/marker
+		matches := markerRegex.FindStringSubmatch(trimmed)
+		if len(matches) == 5 {
+			color, resolveColor := markerColorName(matches[2])
+			marker := Marker{
+				Timecode:     matches[1],
+				Color:        color,
+				Comment:      strings.TrimSpace(matches[4]),
+				ResolveColor: resolveColor,
+			}
+			event.Markers = append(event.Markers, marker)
+		}
+	} else if matches := resolveMarkerRegex.FindStringSubmatch(trimmed); matches != nil {
+		// Resolve marker, at the start of the event
+		duration, _ := strconv.Atoi(matches[3])
+		color, resolveColor := markerColorName(matches[1])
+		marker := Marker{
+			Timecode:     event.SourceIn,
+			Color:        color,
+			Comment:      matches[2],
+			Duration:     duration,
+			ResolveColor: resolveColor,
+		}
+		event.Markers = append(event.Markers, marker)
+	} else if ascSOPRegex.MatchString(trimmed) {
+		// ASC_SOP color correction
+		matches := ascSOPRegex.FindStringSubmatch(trimmed)
+		if len(matches) == 10 {
+			if event.ASCCDL == nil {
+				event.ASCCDL = &ASCCDL{}
+			}
+			for i := 0; i < 3; i++ {
+				event.ASCCDL.Slope[i], _ = strconv.ParseFloat(matches[1+i], 64)
+				event.ASCCDL.Offset[i], _ = strconv.ParseFloat(matches[4+i], 64)
+				event.ASCCDL.Power[i], _ = strconv.ParseFloat(matches[7+i], 64)
+			}
+		}
+	} else if ascSATRegex.MatchString(trimmed) {
+		// ASC_SAT saturation
+		matches := ascSATRegex.FindStringSubmatch(trimmed)
+		if len(matches) == 2 {
+			if event.ASCCDL == nil {
+				event.ASCCDL = &ASCCDL{}
+			}
+			event.ASCCDL.Saturation, _ = strconv.ParseFloat(matches[1], 64)
+		}
+	} else if strings.HasPrefix(trimmed, "*") {
+		// Other comments
+		if event.Comment != "" {
+			event.Comment += "\n"
+		}
+		event.Comment += trimmed
+	} else {
+		return false
+	}
+	return true
+}
+
+// skip starts skipping the lines of an event that cannot be read, and
+// returns the event before it, which is complete.
+func (r *EventReader) skip() *EDLEvent {
+	completed := r.current
+	r.current = nil
+	r.skipping = true
+	return completed
+}
+
+// field is a whitespace separated field of a line.
+type field struct {
+	text   string
+	column int // Column the field starts at, starting at 1
+}
+
+// splitFields splits a line into fields separated by any amount of spaces
+// or tabs.
+func splitFields(line string) []field {
+	var fields []field
+	start := -1
+	for i, c := range line {
+		if unicode.IsSpace(c) {
+			if start >= 0 {
+				fields = append(fields, field{text: line[start:i], column: start + 1})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, field{text: line[start:], column: start + 1})
+	}
+	return fields
+}
+
+// eventFields are the fields of an event line.
+// Format: EVENT# REEL TRACK EDIT_TYPE [TRANSITION_DURATION] [TIMECODES]
+type eventFields struct {
+	number    int
+	reel      string
+	track     field
+	editType  field    // Edit type with "K B" and "K O" joined up
+	duration  int      // Transition duration in frames
+	timecodes []string // Timecodes given on the event line
+}
+
+// parseEventLine parses an event line, an event number followed by at least
+// a reel, track and edit type field. It reports false if the line is not an
+// event line. The track and edit type fields are not checked.
+func parseEventLine(line string) (eventFields, bool) {
+	fields := splitFields(line)
+	if len(fields) < 4 || !isDigits(fields[0].text) {
+		return eventFields{}, false
+	}
+
+	number, _ := strconv.Atoi(fields[0].text)
+	event := eventFields{
+		number:   number,
+		reel:     fields[1].text,
+		track:    fields[2],
+		editType: fields[3],
+	}
+
+	rest := fields[4:]
+	if event.editType.text == "K" && len(rest) > 0 && (rest[0].text == "B" || rest[0].text == "O") {
+		event.editType.text += rest[0].text
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 && isDigits(rest[0].text) {
+		event.duration, _ = strconv.Atoi(rest[0].text)
+		rest = rest[1:]
+	}
+	event.timecodes = fieldTimecodes(rest)
+	return event, true
+}
+
+// speedEffectFieldRegexes match the fields of an M2 line, in order.
+var speedEffectFieldRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`^M2$`),
+	regexp.MustCompile(`^\S+$`),
+	regexp.MustCompile(`^-?[0-9.]+$`),
+	regexp.MustCompile(`^\d{2}:\d{2}:\d{2}[;:]\d{2}`),
+}
+
+// speedEffectColumn returns the column of the first field of an M2 line that
+// cannot be read, or 0 if the line is missing fields.
+func speedEffectColumn(line string) int {
+	fields := splitFields(line)
+	for i, fieldRegex := range speedEffectFieldRegexes {
+		if i >= len(fields) {
+			break
+		}
+		if !fieldRegex.MatchString(fields[i].text) {
+			return fields[i].column
+		}
+	}
+	return 0
+}
+
+// lineTimecodes returns the timecodes a line starts with, if any.
+func lineTimecodes(line string) []string {
+	return fieldTimecodes(splitFields(line))
+}
+
+// fieldTimecodes returns the timecodes at the start of fields.
+func fieldTimecodes(fields []field) []string {
+	var timecodes []string
+	for _, f := range fields {
+		if !timecodeRegex.MatchString(f.text) {
+			break
+		}
+		timecodes = append(timecodes, f.text)
+	}
+	return timecodes
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
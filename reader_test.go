@@ -0,0 +1,430 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package cmx3600
+
+import (
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEventReader_Read(t *testing.T) {
+	edl := `TITLE: Reader Test
+FCM: NON-DROP FRAME
+* PROJECT: Feature
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Shot 1
+
+002  AX       V     C
+     00:00:05:00 00:00:05:00 00:00:05:00 00:00:05:00
+002  BX       V     D    024
+     00:00:00:00 00:00:05:00 00:00:05:00 00:00:10:00
+* FROM CLIP NAME: Shot 1
+* TO CLIP NAME: Shot 2
+`
+
+	reader := NewEventReader(strings.NewReader(edl))
+
+	first, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if first.EventNumber != 1 || first.ClipName != "Shot 1" {
+		t.Errorf("Unexpected first event %+v", first)
+	}
+	if reader.Title() != "Reader Test" {
+		t.Errorf("Expected title 'Reader Test', got '%s'", reader.Title())
+	}
+	if reader.FCM() != "NON-DROP FRAME" {
+		t.Errorf("Expected FCM 'NON-DROP FRAME', got '%s'", reader.FCM())
+	}
+	if strings.Join(reader.HeaderComments(), "\n") != "* PROJECT: Feature" {
+		t.Errorf("Unexpected header comments %q", reader.HeaderComments())
+	}
+
+	second, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if second.EditType != EditTypeDissolve || second.ClipName != "Shot 2" {
+		t.Errorf("Unexpected second event %+v", second)
+	}
+	if second.Outgoing == nil || second.Outgoing.ReelName != "AX" {
+		t.Fatalf("Expected outgoing event from reel AX, got %+v", second.Outgoing)
+	}
+
+	// Each event spans its event line up to its last comment line
+	lines := [][2]int{
+		{first.Line, first.EndLine},
+		{second.Outgoing.Line, second.Outgoing.EndLine},
+		{second.Line, second.EndLine},
+	}
+	expectedLines := [][2]int{{5, 7}, {9, 10}, {11, 14}}
+	if !slices.Equal(lines, expectedLines) {
+		t.Errorf("Expected event lines %v, got %v", expectedLines, lines)
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestEventReader_Events(t *testing.T) {
+	edl := `TITLE: Reader Test
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+002  BX       A     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+003  CX       V     C
+* MISSING TIMECODES
+`
+
+	var reels []string
+	var readErr error
+	for event, err := range NewEventReader(strings.NewReader(edl)).Events() {
+		if err != nil {
+			readErr = err
+			break
+		}
+		reels = append(reels, event.ReelName)
+	}
+
+	if strings.Join(reels, ",") != "AX,BX" {
+		t.Errorf("Expected reels AX,BX, got %v", reels)
+	}
+	if parseErr, ok := readErr.(*ParseError); !ok || parseErr.Line != 8 {
+		t.Errorf("Expected ParseError on line 8, got %v", readErr)
+	}
+}
+
+func TestEventReader_Modes(t *testing.T) {
+	edl := `TITLE: Supplier EDL
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+VENDOR LINE
+002  BX       V     C
+003  CX       A0    C
+     00:00:00:00 00:00:05:00 00:00:05:00 00:00:10:00
+004  DX       V     C
+     00:00:00:00 00:00:05:00 00:00:10:00 00:00:15:00
+M2   DX       bad
+`
+
+	read := func(mode DecodeMode) ([]string, []Diagnostic, error) {
+		reader := NewEventReader(strings.NewReader(edl))
+		reader.SetMode(mode)
+		var reels []string
+		for event, err := range reader.Events() {
+			if err != nil {
+				return reels, reader.Diagnostics(), err
+			}
+			reels = append(reels, event.ReelName)
+		}
+		return reels, reader.Diagnostics(), nil
+	}
+
+	t.Run("lenient", func(t *testing.T) {
+		reels, diagnostics, err := read(DecodeModeLenient)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if strings.Join(reels, ",") != "AX,DX" {
+			t.Errorf("Expected reels AX,DX, got %v", reels)
+		}
+
+		expected := []Diagnostic{
+			{Line: 6, Severity: SeverityWarning, Code: DiagnosticUnknownLine},
+			{Line: 7, Severity: SeverityError, Code: DiagnosticMissingTimecode},
+			{Line: 8, Column: 15, Severity: SeverityError, Code: DiagnosticInvalidTrack},
+			{Line: 12, Column: 15, Severity: SeverityWarning, Code: DiagnosticInvalidSpeedEffect},
+		}
+		if len(diagnostics) != len(expected) {
+			t.Fatalf("Expected %d diagnostics, got %v", len(expected), diagnostics)
+		}
+		for i, want := range expected {
+			got := diagnostics[i]
+			if got.Line != want.Line || got.Column != want.Column || got.Severity != want.Severity || got.Code != want.Code {
+				t.Errorf("Diagnostic %d: expected %v, got %v", i, want, got)
+			}
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		reels, _, err := read(DecodeModeDefault)
+		if parseErr, ok := err.(*ParseError); !ok || parseErr.Line != 7 {
+			t.Errorf("Expected ParseError on line 7, got %v", err)
+		}
+		if strings.Join(reels, ",") != "AX" {
+			t.Errorf("Expected reels AX, got %v", reels)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		_, diagnostics, err := read(DecodeModeStrict)
+		if parseErr, ok := err.(*ParseError); !ok || parseErr.Line != 6 {
+			t.Errorf("Expected ParseError on line 6, got %v", err)
+		}
+		if len(diagnostics) != 1 {
+			t.Errorf("Expected 1 diagnostic, got %v", diagnostics)
+		}
+	})
+}
+
+func TestEventReader_InvalidFields(t *testing.T) {
+	// Event 002 has an unknown track field and event 003 an unknown edit
+	// type. The M2 line of event 004 is indented.
+	edl := `TITLE: Invalid Fields
+FCM: NON-DROP FRAME
+
+001  AX       V     C        00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+002  BX       X     C
+     00:00:05:00 00:00:10:00 00:00:05:00 00:00:10:00
+003  CX       V     Q        00:00:10:00 00:00:15:00 00:00:10:00 00:00:15:00
+004  DX       V     C        01:00:00:00 01:00:01:00 00:00:15:00 00:00:17:00
+  M2   DX       012.0                01:00:00:00
+`
+
+	reader := NewEventReader(strings.NewReader(edl))
+	reader.SetMode(DecodeModeLenient)
+	var events []EDLEvent
+	for event, err := range reader.Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		events = append(events, event)
+	}
+
+	// The invalid events are skipped with their timecodes, rather than
+	// read into the event before
+	if len(events) != 2 || events[0].ReelName != "AX" || events[1].ReelName != "DX" {
+		t.Fatalf("Expected events AX and DX, got %+v", events)
+	}
+	if len(events[0].UnknownLines) != 0 {
+		t.Errorf("Expected no unknown lines on event 001, got %q", events[0].UnknownLines)
+	}
+	if effect := events[1].SpeedEffect; effect == nil || effect.Speed != 12 {
+		t.Errorf("Expected an M2 speed of 12 on event 004, got %+v", effect)
+	}
+
+	expected := []Diagnostic{
+		{Line: 5, Column: 15, Severity: SeverityError, Code: DiagnosticInvalidTrack},
+		{Line: 7, Column: 21, Severity: SeverityError, Code: DiagnosticInvalidEdit},
+	}
+	diagnostics := reader.Diagnostics()
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %v", len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		got := diagnostics[i]
+		if got.Line != want.Line || got.Column != want.Column || got.Severity != want.Severity || got.Code != want.Code {
+			t.Errorf("Diagnostic %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestEventReader_SkippedEvents(t *testing.T) {
+	edl := `TITLE: Skipped Events
+FCM: NON-DROP FRAME
+
+001  AX       V     C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+* FROM CLIP NAME: Shot 1
+002  BX       A0    C
+     00:00:05:00 00:00:10:00 00:00:05:00 00:00:10:00
+* FROM CLIP NAME: Shot 2
+* LOC: 00:00:06:00 RED Skipped
+*ASC_SOP (2.0 2.0 2.0)(0.0 0.0 0.0)(1.0 1.0 1.0)
+003  CX       V     C
+* FROM CLIP NAME: Shot 3
+AUD  3
+004  DX       A     C
+     00:00:15:00 00:00:20:00 00:00:15:00 00:00:20:00
+* FROM CLIP NAME: Shot 4
+`
+
+	reader := NewEventReader(strings.NewReader(edl))
+	reader.SetMode(DecodeModeLenient)
+	var events []EDLEvent
+	for event, err := range reader.Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		events = append(events, event)
+	}
+
+	// The comment lines of skipped events are skipped with them, rather
+	// than read into the event before
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	first := events[0]
+	if first.ClipName != "Shot 1" || len(first.Markers) != 0 || first.ASCCDL != nil || len(first.CommentLines) != 1 || first.EndLine != 6 {
+		t.Errorf("Expected event 001 to keep only its own lines, got %+v", first)
+	}
+	if events[1].ClipName != "Shot 4" || len(events[1].Channels.Audio) != 1 {
+		t.Errorf("Expected event 004 on audio 1, got %+v", events[1])
+	}
+	if len(reader.HeaderComments()) != 0 {
+		t.Errorf("Expected no header comments, got %v", reader.HeaderComments())
+	}
+}
+
+func TestEventReader_Layouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    string
+		editType EditType
+		duration int
+		endLine  int
+	}{
+		{
+			name:     "timecodes on next line",
+			lines:    "001  AX       V     C\n     01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00\n",
+			editType: EditTypeCut,
+			endLine:  2,
+		},
+		{
+			name:     "timecodes on event line",
+			lines:    "001  AX       V     C        01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00\n",
+			editType: EditTypeCut,
+			endLine:  1,
+		},
+		{
+			name:     "timecodes after transition duration",
+			lines:    "001  AX       V     D    024 01:00:00:00 01:00:05:00 00:00:00:00 00:00:05:00\n",
+			editType: EditTypeDissolve,
+			duration: 24,
+			endLine:  1,
+		},
+		{
+			name:     "tabs",
+			lines:    "001\tAX\tV\tC\n\t01:00:00:00\t01:00:05:00\t00:00:00:00\t00:00:05:00\n",
+			editType: EditTypeCut,
+			endLine:  2,
+		},
+		{
+			name:     "wide columns",
+			lines:    "  001    AX         V       K   B      \n  01:00:00:00   01:00:05:00   00:00:00:00   00:00:05:00  \n",
+			editType: EditTypeKeyBackground,
+			endLine:  2,
+		},
+		{
+			name:     "split timecodes",
+			lines:    "001  AX       V     W001 030 01:00:00:00 01:00:05:00\n     00:00:00:00\n     00:00:05:00\n",
+			editType: EditTypeWipe,
+			duration: 30,
+			endLine:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The comment line after the timecodes belongs to the event, and
+			// is not read as its timecode line
+			edl := tt.lines + "* FROM CLIP NAME: Shot 1\n"
+
+			var events []EDLEvent
+			for event, err := range NewEventReader(strings.NewReader(edl)).Events() {
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				events = append(events, event)
+			}
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+
+			event := events[0]
+			if event.EventNumber != 1 || event.ReelName != "AX" || event.TrackType != TrackTypeVideo {
+				t.Errorf("Unexpected event fields %+v", event)
+			}
+			if event.EditType != tt.editType || event.TransitionDuration != tt.duration {
+				t.Errorf("Expected edit type %s with duration %d, got %s with %d",
+					tt.editType, tt.duration, event.EditType, event.TransitionDuration)
+			}
+			timecodes := []string{event.SourceIn, event.SourceOut, event.RecordIn, event.RecordOut}
+			expected := []string{"01:00:00:00", "01:00:05:00", "00:00:00:00", "00:00:05:00"}
+			if !slices.Equal(timecodes, expected) {
+				t.Errorf("Expected timecodes %v, got %v", expected, timecodes)
+			}
+			if event.ClipName != "Shot 1" {
+				t.Errorf("Expected clip name 'Shot 1', got '%s'", event.ClipName)
+			}
+			if event.Line != 1 || event.EndLine != tt.endLine+1 {
+				t.Errorf("Expected lines 1-%d, got %d-%d", tt.endLine+1, event.Line, event.EndLine)
+			}
+		})
+	}
+}
+
+func TestEventReader_ComprehensiveFeatures(t *testing.T) {
+	file, err := os.Open("testdata/comprehensive_features.edl")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+
+	reader := NewEventReader(file)
+	var clipNames []string
+	for event, err := range reader.Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		clipNames = append(clipNames, event.ClipName)
+	}
+
+	expected := []string{"BlackLeader", "Speed_Clip", "ColorBars", "Wipe_Clip", "FrozenClip FF", "BlackTail"}
+	if !slices.Equal(clipNames, expected) {
+		t.Errorf("Expected clips %v, got %v", expected, clipNames)
+	}
+	if len(reader.Diagnostics()) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", reader.Diagnostics())
+	}
+}
+
+func TestEventReader_ResolveMarkers(t *testing.T) {
+	edl := `TITLE: Timeline 1
+FCM: NON-DROP FRAME
+
+001  001      V     C        01:00:05:00 01:00:05:12 01:00:05:00 01:00:05:12
+* SOURCE FILE: /media/A001C003.mov
+* LOC: 01:00:05:06 ResolveColorSky Second
+ |C:ResolveColorBlue |M:Check focus |D:12
+`
+
+	reader := NewEventReader(strings.NewReader(edl))
+	var events []EDLEvent
+	for event, err := range reader.Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 1 || len(reader.Diagnostics()) != 0 {
+		t.Fatalf("Expected 1 event and no diagnostics, got %d and %v", len(events), reader.Diagnostics())
+	}
+
+	event := events[0]
+	if event.FilePath != "/media/A001C003.mov" {
+		t.Errorf("Expected file path '/media/A001C003.mov', got '%s'", event.FilePath)
+	}
+	expected := []Marker{
+		{Timecode: "01:00:05:06", Color: "CYAN", Comment: "Second", ResolveColor: "ResolveColorSky"},
+		{Timecode: "01:00:05:00", Color: "BLUE", Comment: "Check focus", Duration: 12, ResolveColor: "ResolveColorBlue"},
+	}
+	if !slices.Equal(event.Markers, expected) {
+		t.Errorf("Expected markers %v, got %v", expected, event.Markers)
+	}
+	if len(event.CommentLines) != 3 || len(event.UnknownLines) != 0 {
+		t.Errorf("Expected 3 comment lines, got %q and unknown lines %q", event.CommentLines, event.UnknownLines)
+	}
+}
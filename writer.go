@@ -0,0 +1,567 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package cmx3600
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxEventNumber is the largest event number that fits the three digit event
+// number field of a CMX 3600 EDL.
+const maxEventNumber = 999
+
+// maxTransitionDuration is the largest transition duration, in frames, that
+// fits the three digit duration field.
+const maxTransitionDuration = 999
+
+// maxTitleLength is the longest TITLE allowed by the CMX 3600 specification.
+const maxTitleLength = 70
+
+// timecodeRegex matches a timecode field.
+var timecodeRegex = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}[;:]\d{2}$`)
+
+// markerColorRegex matches a locator color that reads back as one word.
+var markerColorRegex = regexp.MustCompile(`^\w+$`)
+
+// EventWriter writes EDL events to a CMX 3600 EDL, without an OpenTimelineIO
+// timeline. Events that cannot be represented in the EDL are rejected with
+// an *EncodeError.
+type EventWriter struct {
+	w              io.Writer
+	style          OutputStyle
+	reelNameLen    int
+	reelNameLenSet bool // Whether the reel name length was set, not taken from the style
+	cdlPrecision   int
+}
+
+// NewEventWriter creates a new EDL event writer.
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{
+		w:            w,
+		style:        OutputStyleAvid,
+		reelNameLen:  DefaultReelNameLength,
+		cdlPrecision: -1,
+	}
+}
+
+// SetStyle sets the output style (avid, nucoda, premiere, cmx3600,
+// resolve), and the reel name length to the style's limit unless it has been
+// set with SetReelNameLength. The cmx3600 style also enforces the title
+// limit of the specification.
+func (w *EventWriter) SetStyle(style OutputStyle) {
+	w.style = style
+	if !w.reelNameLenSet {
+		w.reelNameLen = style.rules().reelNameLen
+	}
+}
+
+// SetReelNameLength sets the maximum length for reel names, in place of the
+// limit of the style whether the style is set before or after.
+// Use 0 or negative for unlimited length.
+func (w *EventWriter) SetReelNameLength(length int) {
+	w.reelNameLen = length
+	w.reelNameLenSet = true
+}
+
+// SetCDLPrecision sets the number of decimal places written for ASC_SOP and
+// ASC_SAT values. Use a negative value for the fewest digits that read back
+// as the same value.
+func (w *EventWriter) SetCDLPrecision(digits int) {
+	w.cdlPrecision = digits
+}
+
+// WriteHeader writes the TITLE and FCM lines, followed by any header comment
+// lines and a blank line.
+func (w *EventWriter) WriteHeader(title string, dropFrame bool, comments []string) error {
+	if strings.ContainsAny(title, "\r\n") {
+		return &EncodeError{Field: "title", Message: "title must be a single line"}
+	}
+	if w.style == OutputStyleCMX3600 && len(title) > maxTitleLength {
+		return &EncodeError{Field: "title", Message: fmt.Sprintf("title is longer than %d characters", maxTitleLength)}
+	}
+	for _, comment := range comments {
+		if strings.ContainsAny(comment, "\r\n") {
+			return &EncodeError{Field: "header comment", Message: "header comments must be single lines"}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w.w, "TITLE: %s\n", title); err != nil {
+		return err
+	}
+
+	// Write FCM (Frame Count Mode)
+	fcm := "NON-DROP FRAME"
+	if dropFrame {
+		fcm = "DROP FRAME"
+	}
+	if _, err := fmt.Fprintf(w.w, "FCM: %s\n", fcm); err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		if _, err := fmt.Fprintf(w.w, "%s\n", comment); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w.w, "\n")
+	return err
+}
+
+// WriteEvent writes a single EDL event with its comment, M2, LOC and ASC
+// lines. A dissolve, wipe or key with an outgoing side is written as the
+// outgoing line followed by the event line, both with the same event number.
+// Comment lines kept from a decoded EDL are written verbatim in place of the
+// comments generated from the other fields, as long as they still describe
+// those fields; unknown lines are always written as they were read.
+func (w *EventWriter) WriteEvent(event EDLEvent) error {
+	if event.Outgoing != nil {
+		if err := w.validate(*event.Outgoing); err != nil {
+			return err
+		}
+	}
+	if err := w.validate(event); err != nil {
+		return err
+	}
+
+	if event.Outgoing != nil {
+		if err := w.writeEventLines(*event.Outgoing); err != nil {
+			return err
+		}
+		if err := w.writeLines(rawLines(*event.Outgoing)); err != nil {
+			return err
+		}
+	}
+
+	if err := w.writeEventLines(event); err != nil {
+		return err
+	}
+
+	// Write M2 motion effect
+	if effect := event.SpeedEffect; effect != nil {
+		if _, err := fmt.Fprintf(w.w, "M2   %-8s %05.1f    %s\n", effect.Name, effect.Speed, effect.Timecode); err != nil {
+			return err
+		}
+	}
+
+	// Comment lines read from an EDL are written back as they were, unless
+	// the clip name, path, markers, CDL or comment have been changed since
+	comments := event.CommentLines
+	if !commentLinesMatch(event) {
+		comments = w.comments(event)
+	}
+	if err := w.writeLines(comments); err != nil {
+		return err
+	}
+	if err := w.writeLines(event.UnknownLines); err != nil {
+		return err
+	}
+
+	// Add blank line between events for readability
+	_, err := fmt.Fprintf(w.w, "\n")
+	return err
+}
+
+// comments returns the comment lines generated from the clip name, path,
+// markers, CDL, freeze frame and comment of an event.
+func (w *EventWriter) comments(event EDLEvent) []string {
+	var comments []string
+
+	// Write clip name comments if present
+	if event.Outgoing != nil {
+		if event.Outgoing.ClipName != "" {
+			comments = append(comments, "* FROM CLIP NAME: "+event.Outgoing.ClipName)
+		}
+		if event.ClipName != "" {
+			comments = append(comments, "* TO CLIP NAME: "+event.ClipName)
+		}
+	} else if event.ClipName != "" {
+		comments = append(comments, "* FROM CLIP NAME: "+event.ClipName)
+	}
+
+	// File paths are FROM FILE comments in Nucoda style and FROM CLIP
+	// comments otherwise
+	if event.FilePath != "" {
+		comments = append(comments, fmt.Sprintf("* %s: %s", w.style.rules().pathKeyword, event.FilePath))
+	}
+
+	// Resolve reads markers at the start of an event from its own marker
+	// lines, which have no timecode of their own
+	for _, marker := range event.Markers {
+		color := w.markerColor(marker)
+		if w.style.rules().resolveMarkers && marker.Timecode == event.SourceIn {
+			comments = append(comments, fmt.Sprintf(" |C:%s |M:%s |D:%d", color, marker.Comment, max(marker.Duration, 1)))
+			continue
+		}
+
+		// The colour is padded to line up the comments, which a locator
+		// without a comment does not need
+		loc := fmt.Sprintf("* LOC: %s %-7s %s", marker.Timecode, color, marker.Comment)
+		comments = append(comments, strings.TrimRight(loc, " "))
+	}
+
+	// Avid writes ASC CDL lines without a space after the asterisk, which
+	// other systems put in as for any other comment
+	if cdl := event.ASCCDL; cdl != nil {
+		prefix := "* "
+		if w.style == OutputStyleAvid {
+			prefix = "*"
+		}
+		comments = append(comments,
+			fmt.Sprintf("%sASC_SOP (%s)(%s)(%s)", prefix,
+				formatCDLValues(cdl.Slope, w.cdlPrecision), formatCDLValues(cdl.Offset, w.cdlPrecision), formatCDLValues(cdl.Power, w.cdlPrecision)),
+			prefix+"ASC_SAT "+strconv.FormatFloat(cdl.Saturation, 'f', w.cdlPrecision, 64),
+		)
+	}
+
+	if event.FreezeFrame {
+		comments = append(comments, "* FREEZE FRAME")
+	}
+
+	// Other comments are written as they were read, one comment per line
+	if event.Comment != "" {
+		for _, line := range strings.Split(event.Comment, "\n") {
+			if line = strings.TrimSpace(line); !strings.HasPrefix(line, "*") {
+				line = "* " + line
+			}
+			comments = append(comments, line)
+		}
+	}
+
+	return comments
+}
+
+// markerColor returns the colour written for a marker. Resolve writes its
+// own colour names, which other colours are mapped to as by the Encoder:
+// the Resolve colour the marker was read with, if it still matches, or else
+// the Resolve colour of the marker colour.
+func (w *EventWriter) markerColor(marker Marker) string {
+	if !w.style.rules().resolveMarkers || strings.HasPrefix(marker.Color, resolveColorPrefix) {
+		return marker.Color
+	}
+
+	color := strings.ToUpper(marker.Color)
+	if strings.HasPrefix(marker.ResolveColor, resolveColorPrefix) {
+		if decoded, _ := markerColorName(marker.ResolveColor); decoded == color {
+			return marker.ResolveColor
+		}
+	}
+	colors := markerColors[OutputStyleResolve]
+	if mapped, ok := colors[color]; ok {
+		return mapped
+	}
+	return colors["RED"]
+}
+
+// commentLinesMatch reports whether the comment lines kept from a decoded
+// EDL, read again, give the comment fields the event has now.
+func commentLinesMatch(event EDLEvent) bool {
+	parsed := EDLEvent{SourceIn: event.SourceIn}
+	if event.Outgoing != nil {
+		parsed.Outgoing = &EDLEvent{}
+	}
+	for _, line := range event.CommentLines {
+		parseCommentLine(&parsed, line)
+	}
+
+	if event.Outgoing != nil && parsed.Outgoing.ClipName != event.Outgoing.ClipName {
+		return false
+	}
+	if (parsed.ASCCDL == nil) != (event.ASCCDL == nil) ||
+		(parsed.ASCCDL != nil && *parsed.ASCCDL != *event.ASCCDL) {
+		return false
+	}
+	return parsed.ClipName == event.ClipName &&
+		parsed.FilePath == event.FilePath &&
+		parsed.FreezeFrame == event.FreezeFrame &&
+		parsed.Comment == event.Comment &&
+		slices.Equal(parsed.Markers, event.Markers)
+}
+
+// rawLines returns the comment and unrecognised lines of an event as they
+// were read, or nil if the event has none.
+func rawLines(event EDLEvent) []string {
+	if len(event.CommentLines) == 0 && len(event.UnknownLines) == 0 {
+		return nil
+	}
+	return append(slices.Clone(event.CommentLines), event.UnknownLines...)
+}
+
+// writeLines writes each line followed by a newline.
+func (w *EventWriter) writeLines(lines []string) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w.w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks that every field of an event can be written to, and read
+// back from, a CMX 3600 EDL.
+func (w *EventWriter) validate(event EDLEvent) error {
+	invalid := func(field, format string, args ...interface{}) error {
+		return &EncodeError{EventNumber: event.EventNumber, Field: field, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if event.EventNumber < 1 {
+		return invalid("event number", "event number %d is not positive", event.EventNumber)
+	}
+	if event.EventNumber > maxEventNumber {
+		return invalid("event number", "event number is larger than %d", maxEventNumber)
+	}
+
+	if err := w.validateReelName(event.ReelName); err != nil {
+		return invalid("reel", "%s", err)
+	}
+
+	if w.style == OutputStyleCMX3600 {
+		if _, _, err := strictTrackField(eventChannels(event)); err != nil {
+			return invalid("track", "%s", err)
+		}
+	} else if _, err := ParseChannels(string(event.TrackType)); err != nil || strings.ContainsAny(string(event.TrackType), " \t") {
+		return invalid("track", "invalid track field %q", event.TrackType)
+	}
+
+	switch event.EditType {
+	case EditTypeCut, EditTypeDissolve, EditTypeKeyBackground, EditTypeKey, EditTypeKeyOut:
+	case EditTypeWipe:
+		if !wipeCodeRegex.MatchString(event.WipeCode) {
+			return invalid("wipe code", "invalid wipe code %q", event.WipeCode)
+		}
+	default:
+		return invalid("edit type", "invalid edit type %q", event.EditType)
+	}
+	if event.TransitionDuration < 0 || event.TransitionDuration > maxTransitionDuration {
+		return invalid("transition duration", "transition duration %d is not between 0 and %d frames", event.TransitionDuration, maxTransitionDuration)
+	}
+
+	timecodes := []struct {
+		field string
+		value string
+	}{
+		{"source in", event.SourceIn},
+		{"source out", event.SourceOut},
+		{"record in", event.RecordIn},
+		{"record out", event.RecordOut},
+	}
+	for _, timecode := range timecodes {
+		if !timecodeRegex.MatchString(timecode.value) {
+			return invalid(timecode.field, "invalid timecode %q", timecode.value)
+		}
+	}
+
+	if strings.ContainsAny(event.ClipName, "\r\n") {
+		return invalid("clip name", "clip name must be a single line")
+	}
+	if strings.ContainsAny(event.FilePath, "\r\n") {
+		return invalid("file path", "file path must be a single line")
+	}
+
+	if effect := event.SpeedEffect; effect != nil {
+		if err := w.validateReelName(effect.Name); err != nil {
+			return invalid("speed effect", "%s", err)
+		}
+		if !timecodeRegex.MatchString(effect.Timecode) {
+			return invalid("speed effect", "invalid timecode %q", effect.Timecode)
+		}
+		if math.Abs(effect.Speed) >= 999.95 {
+			return invalid("speed effect", "speed %.1f does not fit the M2 speed field", effect.Speed)
+		}
+	}
+
+	for _, line := range event.CommentLines {
+		isComment := strings.HasPrefix(line, "*") || resolveMarkerRegex.MatchString(line)
+		if !isComment || strings.ContainsAny(line, "\r\n") {
+			return invalid("comment", "invalid comment line %q", line)
+		}
+	}
+	for _, line := range event.UnknownLines {
+		_, isEventLine := parseEventLine(line)
+		if strings.ContainsAny(line, "\r\n") || isEventLine || len(lineTimecodes(line)) > 0 {
+			return invalid("unknown line", "invalid line %q", line)
+		}
+	}
+
+	for _, marker := range event.Markers {
+		if !timecodeRegex.MatchString(marker.Timecode) {
+			return invalid("marker", "invalid timecode %q", marker.Timecode)
+		}
+		if !markerColorRegex.MatchString(marker.Color) {
+			return invalid("marker", "invalid marker color %q", marker.Color)
+		}
+		if strings.ContainsAny(marker.Comment, "\r\n") {
+			return invalid("marker", "marker comment must be a single line")
+		}
+		if w.style.rules().resolveMarkers && strings.Contains(marker.Comment, "|") {
+			return invalid("marker", "marker comment %q cannot be written as a Resolve marker", marker.Comment)
+		}
+		if marker.Duration < 0 {
+			return invalid("marker", "marker duration %d is negative", marker.Duration)
+		}
+	}
+
+	return nil
+}
+
+// validateReelName checks that a reel name is a single word that fits the
+// reel name length.
+func (w *EventWriter) validateReelName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("invalid reel name %q", name)
+	}
+	if w.reelNameLen > 0 && len(name) > w.reelNameLen {
+		return fmt.Errorf("reel name %q is longer than %d characters", name, w.reelNameLen)
+	}
+	return nil
+}
+
+// writeEventLines writes the event and timecode lines of an event.
+func (w *EventWriter) writeEventLines(event EDLEvent) error {
+	editType := string(event.EditType)
+	if event.EditType == EditTypeWipe && event.WipeCode != "" {
+		editType = event.WipeCode
+	}
+	if event.EditType == EditTypeKeyOut {
+		editType = "K O"
+	}
+
+	trackField := string(event.TrackType)
+	var audioLine []int
+	if w.style == OutputStyleCMX3600 {
+		// The channels were checked by validate
+		trackField, audioLine, _ = strictTrackField(eventChannels(event))
+	} else {
+		// Channels 3 and 4 added to the track field by an AUD line
+		fieldChannels, _ := event.TrackType.Channels()
+		for _, n := range eventChannels(event).Audio {
+			if (n == 3 || n == 4) && !slices.Contains(fieldChannels.Audio, n) {
+				audioLine = append(audioLine, n)
+			}
+		}
+	}
+
+	duration := ""
+	if (event.EditType == EditTypeDissolve || event.EditType == EditTypeWipe || event.EditType.IsKey()) && event.TransitionDuration > 0 {
+		duration = fmt.Sprintf("%03d", event.TransitionDuration)
+	}
+	timecodes := fmt.Sprintf("%s %s %s %s",
+		event.SourceIn,
+		event.SourceOut,
+		event.RecordIn,
+		event.RecordOut,
+	)
+
+	var err error
+	if w.style.rules().inlineTimecodes {
+		// Fields in the columns of the specification, with the timecodes
+		// starting at column 30
+		_, err = fmt.Fprintf(w.w, "%03d  %-8s %-5s %-4s %3s %s\n",
+			event.EventNumber,
+			event.ReelName,
+			trackField,
+			editType,
+			duration,
+			timecodes,
+		)
+	} else {
+		// Write event line
+		eventLine := fmt.Sprintf("%03d  %-8s %s    %-2s",
+			event.EventNumber,
+			event.ReelName,
+			trackField,
+			editType,
+		)
+
+		// Add transition duration if applicable
+		if duration != "" {
+			eventLine += "   " + duration
+		}
+
+		// Write timecode line
+		_, err = fmt.Fprintf(w.w, "%s\n     %s\n", eventLine, timecodes)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Write AUD line for audio channels 3 and 4
+	if len(audioLine) > 0 {
+		channels := make([]string, len(audioLine))
+		for i, n := range audioLine {
+			channels[i] = strconv.Itoa(n)
+		}
+		_, err = fmt.Fprintf(w.w, "AUD  %s\n", strings.Join(channels, " "))
+	}
+	return err
+}
+
+// formatCDLValues formats the RGB values of an ASC_SOP group with precision
+// decimal places, or the fewest that read back exactly when negative.
+func formatCDLValues(values [3]float64, precision int) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = strconv.FormatFloat(value, 'f', precision, 64)
+	}
+	return strings.Join(formatted, " ")
+}
+
+// eventChannels returns the channels of an event, parsed from its track
+// field when the event has no channel set.
+func eventChannels(event EDLEvent) ChannelSet {
+	if event.Channels.Video || len(event.Channels.Audio) > 0 {
+		return event.Channels
+	}
+	channels, _ := event.TrackType.Channels()
+	return channels
+}
+
+// strictTrackField splits a channel set into a CMX 3600 track field covering
+// video and audio channels 1 and 2, and the channels 3 and 4 that are written
+// on an AUD line. Video with audio 1 alone is written as B.
+func strictTrackField(channels ChannelSet) (string, []int, error) {
+	var audio1, audio2 bool
+	var audioLine []int
+	for _, n := range channels.Audio {
+		switch n {
+		case 1:
+			audio1 = true
+		case 2:
+			audio2 = true
+		case 3, 4:
+			audioLine = append(audioLine, n)
+		default:
+			return "", nil, fmt.Errorf("audio channel %d cannot be written in a CMX 3600 EDL", n)
+		}
+	}
+
+	field := ""
+	switch {
+	case audio1 && audio2:
+		field = "AA"
+	case audio1:
+		field = "A"
+	case audio2:
+		field = "A2"
+	}
+
+	switch {
+	case channels.Video && field == "":
+		field = "V"
+	case channels.Video && field == "A":
+		field = "B"
+	case channels.Video:
+		field += "/V"
+	case field == "":
+		field = "NONE"
+	}
+
+	return field, audioLine, nil
+}
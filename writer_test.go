@@ -0,0 +1,292 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package cmx3600
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventWriter_RoundTrip(t *testing.T) {
+	events := []EDLEvent{
+		{
+			EventNumber: 1,
+			ReelName:    "A001C003",
+			TrackType:   TrackTypeVideo,
+			EditType:    EditTypeCut,
+			SourceIn:    "01:00:00:00",
+			SourceOut:   "01:00:05:00",
+			RecordIn:    "00:00:00:00",
+			RecordOut:   "00:00:05:00",
+			ClipName:    "Shot 1",
+			FilePath:    "/media/A001C003.mov",
+			SpeedEffect: &SpeedEffect{Name: "A001C003", Speed: 48, Timecode: "01:00:00:00"},
+			Markers:     []Marker{{Timecode: "01:00:01:00", Color: "RED", Comment: "Fix this"}},
+			ASCCDL: &ASCCDL{
+				Slope:      [3]float64{1.1, 1, 0.95},
+				Offset:     [3]float64{0, -0.01, 0.02},
+				Power:      [3]float64{1, 1, 1},
+				Saturation: 0.9,
+			},
+			Comment: "* VFX SHOT",
+		},
+		{
+			EventNumber:        2,
+			ReelName:           "B002",
+			TrackType:          TrackTypeVideo,
+			EditType:           EditTypeWipe,
+			WipeCode:           "W001",
+			TransitionDuration: 24,
+			SourceIn:           "02:00:00:00",
+			SourceOut:          "02:00:05:00",
+			RecordIn:           "00:00:05:00",
+			RecordOut:          "00:00:10:00",
+			ClipName:           "Shot 2",
+			FreezeFrame:        true,
+			Outgoing: &EDLEvent{
+				EventNumber: 2,
+				ReelName:    "A001C003",
+				TrackType:   TrackTypeVideo,
+				EditType:    EditTypeCut,
+				SourceIn:    "01:00:05:00",
+				SourceOut:   "01:00:05:00",
+				RecordIn:    "00:00:05:00",
+				RecordOut:   "00:00:05:00",
+				ClipName:    "Shot 1",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	writer := NewEventWriter(&buf)
+	if err := writer.WriteHeader("Shot Database", false, []string{"* SOURCE: shots.db"}); err != nil {
+		t.Fatalf("WriteHeader() error = %v", err)
+	}
+	for _, event := range events {
+		if err := writer.WriteEvent(event); err != nil {
+			t.Fatalf("WriteEvent() error = %v", err)
+		}
+	}
+
+	reader := NewEventReader(strings.NewReader(buf.String()))
+	var decoded []EDLEvent
+	for event, err := range reader.Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v\n%s", err, buf.String())
+		}
+		decoded = append(decoded, event)
+	}
+
+	if reader.Title() != "Shot Database" || reader.FCM() != "NON-DROP FRAME" {
+		t.Errorf("Unexpected header %q %q", reader.Title(), reader.FCM())
+	}
+	if len(decoded) != len(events) {
+		t.Fatalf("Expected %d events, got %d:\n%s", len(events), len(decoded), buf.String())
+	}
+
+	// The reader fills in the channels parsed from the track field, and
+	// keeps the line numbers and comment lines as written
+	for i := range events {
+		events[i].Channels = ChannelSet{Video: true}
+		if events[i].Outgoing != nil {
+			events[i].Outgoing.Channels = ChannelSet{Video: true}
+			decoded[i].Outgoing.Line = 0
+			decoded[i].Outgoing.EndLine = 0
+		}
+		decoded[i].Line = 0
+		decoded[i].EndLine = 0
+		decoded[i].CommentLines = nil
+		if !reflect.DeepEqual(decoded[i], events[i]) {
+			t.Errorf("Event %d round trip mismatch:\nwant %+v\ngot  %+v\n%s", i+1, events[i], decoded[i], buf.String())
+		}
+	}
+}
+
+func TestEventWriter_Invalid(t *testing.T) {
+	valid := EDLEvent{
+		EventNumber: 1,
+		ReelName:    "AX",
+		TrackType:   TrackTypeVideo,
+		EditType:    EditTypeCut,
+		SourceIn:    "00:00:00:00",
+		SourceOut:   "00:00:05:00",
+		RecordIn:    "00:00:00:00",
+		RecordOut:   "00:00:05:00",
+	}
+
+	tests := []struct {
+		name   string
+		style  OutputStyle
+		modify func(*EDLEvent)
+		field  string
+	}{
+		{"event number", OutputStyleAvid, func(e *EDLEvent) { e.EventNumber = 0 }, "event number"},
+		{"strict event number", OutputStyleCMX3600, func(e *EDLEvent) { e.EventNumber = 1000 }, "event number"},
+		{"long event number", OutputStyleNucoda, func(e *EDLEvent) { e.EventNumber = 1000 }, "event number"},
+		{"long reel", OutputStyleAvid, func(e *EDLEvent) { e.ReelName = "LONGREELNAME" }, "reel"},
+		{"reel with space", OutputStyleAvid, func(e *EDLEvent) { e.ReelName = "A X" }, "reel"},
+		{"track", OutputStyleAvid, func(e *EDLEvent) { e.TrackType = "X" }, "track"},
+		{"strict track", OutputStyleCMX3600, func(e *EDLEvent) { e.TrackType = "A5" }, "track"},
+		{"wipe code", OutputStyleAvid, func(e *EDLEvent) { e.EditType = EditTypeWipe }, "wipe code"},
+		{"transition duration", OutputStyleAvid, func(e *EDLEvent) {
+			e.EditType = EditTypeDissolve
+			e.TransitionDuration = 1000
+		}, "transition duration"},
+		{"timecode", OutputStyleAvid, func(e *EDLEvent) { e.RecordOut = "1:00:05:00" }, "record out"},
+		{"speed", OutputStyleAvid, func(e *EDLEvent) {
+			e.SpeedEffect = &SpeedEffect{Name: "AX", Speed: 1200, Timecode: "00:00:00:00"}
+		}, "speed effect"},
+		{"marker color", OutputStyleAvid, func(e *EDLEvent) { e.Markers = []Marker{{Timecode: "00:00:01:00", Color: "DARK RED"}} }, "marker"},
+		{"empty marker color", OutputStyleAvid, func(e *EDLEvent) { e.Markers = []Marker{{Timecode: "00:00:01:00", Comment: "Note"}} }, "marker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := valid
+			tt.modify(&event)
+
+			var buf bytes.Buffer
+			writer := NewEventWriter(&buf)
+			writer.SetStyle(tt.style)
+
+			err := writer.WriteEvent(event)
+			encodeErr, ok := err.(*EncodeError)
+			if !ok {
+				t.Fatalf("Expected EncodeError, got %v", err)
+			}
+			if encodeErr.Field != tt.field {
+				t.Errorf("Expected field %q, got %q", tt.field, encodeErr.Field)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("Expected nothing written, got:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestEventWriter_LocatorWithoutComment(t *testing.T) {
+	event := EDLEvent{
+		EventNumber: 1,
+		ReelName:    "AX",
+		TrackType:   TrackTypeVideo,
+		EditType:    EditTypeCut,
+		SourceIn:    "00:00:00:00",
+		SourceOut:   "00:00:05:00",
+		RecordIn:    "00:00:00:00",
+		RecordOut:   "00:00:05:00",
+		Markers:     []Marker{{Timecode: "00:00:01:00", Color: "RED"}},
+	}
+
+	var buf bytes.Buffer
+	writer := NewEventWriter(&buf)
+	if err := writer.WriteEvent(event); err != nil {
+		t.Fatalf("WriteEvent() error = %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "\n* LOC: 00:00:01:00 RED\n") {
+		t.Errorf("Expected the LOC line without trailing spaces, got:\n%s", buf.String())
+	}
+}
+
+func TestEventWriter_ResolveMarkerColors(t *testing.T) {
+	event := EDLEvent{
+		EventNumber: 1,
+		ReelName:    "AX",
+		TrackType:   TrackTypeVideo,
+		EditType:    EditTypeCut,
+		SourceIn:    "01:00:00:00",
+		SourceOut:   "01:00:05:00",
+		RecordIn:    "00:00:00:00",
+		RecordOut:   "00:00:05:00",
+		Markers: []Marker{
+			{Timecode: "01:00:00:00", Color: "RED", Comment: "Start", Duration: 1},
+			{Timecode: "01:00:01:00", Color: "PINK", Comment: "Rose", ResolveColor: "ResolveColorRose"},
+			{Timecode: "01:00:02:00", Color: "ResolveColorMint", Comment: "Mint"},
+		},
+	}
+
+	var buf bytes.Buffer
+	writer := NewEventWriter(&buf)
+	writer.SetStyle(OutputStyleResolve)
+	if err := writer.WriteEvent(event); err != nil {
+		t.Fatalf("WriteEvent() error = %v", err)
+	}
+
+	// Colours are written as Resolve colours, and read back as the same
+	// marker colours
+	for _, line := range []string{
+		"\n |C:ResolveColorRed |M:Start |D:1\n",
+		"\n* LOC: 01:00:01:00 ResolveColorRose Rose\n",
+		"\n* LOC: 01:00:02:00 ResolveColorMint Mint\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected line %q in output:\n%s", strings.TrimSpace(line), buf.String())
+		}
+	}
+
+	reader := NewEventReader(strings.NewReader(buf.String()))
+	decoded, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	var colors []string
+	for _, marker := range decoded.Markers {
+		colors = append(colors, marker.Color)
+	}
+	if strings.Join(colors, ",") != "RED,PINK,GREEN" {
+		t.Errorf("Expected marker colours RED,PINK,GREEN, got %v", colors)
+	}
+}
+
+func TestEventWriter_Verbatim(t *testing.T) {
+	edl := `TITLE: Verbatim
+FCM: NON-DROP FRAME
+
+001  AX       AA    C
+     00:00:00:00 00:00:05:00 00:00:00:00 00:00:05:00
+AUD  3
+* FROM CLIP NAME:  Shot 1
+*ASC_SOP (1.0000 1.0000 1.0000)(0.0000 0.0000 0.0000)(1.0000 1.0000 1.0000)
+* SUPPLIER NOTE
+VENDOR LINE
+
+002  BX       AA    C
+     00:00:05:00 00:00:10:00 00:00:05:00 00:00:10:00
+* FROM CLIP NAME:  Shot 2
+
+`
+
+	var buf bytes.Buffer
+	writer := NewEventWriter(&buf)
+	reader := NewEventReader(strings.NewReader(edl))
+	for event, err := range reader.Events() {
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if event.EventNumber == 1 {
+			if strings.Join(event.UnknownLines, "\n") != "VENDOR LINE" {
+				t.Errorf("Expected unknown line 'VENDOR LINE', got %q", event.UnknownLines)
+			}
+			// The title has been read once the first event is complete
+			if err := writer.WriteHeader(reader.Title(), false, nil); err != nil {
+				t.Fatalf("WriteHeader() error = %v", err)
+			}
+		}
+		if err := writer.WriteEvent(event); err != nil {
+			t.Fatalf("WriteEvent() error = %v", err)
+		}
+	}
+
+	if normalizeWhitespace(buf.String()) != normalizeWhitespace(edl) {
+		t.Errorf("Round trip mismatch:\nwant:\n%s\ngot:\n%s", edl, buf.String())
+	}
+}
+
+// normalizeWhitespace collapses runs of whitespace, so that EDLs can be
+// compared apart from column alignment.
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}